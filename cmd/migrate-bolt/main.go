@@ -0,0 +1,80 @@
+// Command migrate-bolt copies clans, players, tank averages and snapshots from MongoDB into a bolt database file
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/cufee/am-clanactivity/config"
+	mongo "github.com/cufee/am-clanactivity/mongoapi"
+	"github.com/cufee/am-clanactivity/store"
+	"github.com/cufee/am-clanactivity/store/bolt"
+)
+
+func main() {
+	configPath := flag.String("config", "config.json", "path to JSON config file with mongo settings")
+	outPath := flag.String("out", "", "bolt database file to write, defaults to storage.bolt_path")
+	flag.Parse()
+
+	cfg, err := config.Read(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Mongo.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *outPath == "" {
+		*outPath = cfg.Storage.BoltPath
+	}
+	if *outPath == "" {
+		log.Fatal("no bolt database file, set -out or storage.bolt_path")
+	}
+
+	src, err := mongo.New(cfg.Mongo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer src.Close(context.Background())
+
+	dst, err := bolt.New(*outPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dst.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Documents keyed by WG ID alone decode without their ID and would overwrite each other, documents without a realm would be copied to none
+	legacy, err := src.CountLegacyKeys(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if legacy > 0 {
+		log.Fatalf("%d documents in MongoDB are not keyed by realm yet, run migrate-realms first", legacy)
+	}
+
+	clans, err := src.ListClans(ctx)
+	if err != nil {
+		log.Fatal("reading clans: ", err)
+	}
+	players, err := src.ListPlayers(ctx)
+	if err != nil {
+		log.Fatal("reading players: ", err)
+	}
+	tanks, err := src.ListTankAverages(ctx)
+	if err != nil {
+		log.Fatal("reading tank averages: ", err)
+	}
+	snapshots, err := src.GetSnapshots(ctx, store.SnapshotFilter{})
+	if err != nil {
+		log.Fatal("reading snapshots: ", err)
+	}
+
+	if err := dst.Import(ctx, clans, players, tanks, snapshots); err != nil {
+		log.Fatal("writing bolt database: ", err)
+	}
+	log.Printf("Copied %d clans, %d players, %d tank averages and %d snapshots into %s", len(clans), len(players), len(tanks), len(snapshots), *outPath)
+}
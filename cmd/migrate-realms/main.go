@@ -0,0 +1,72 @@
+// Command migrate-realms rekeys records stored before realms were part of their keys
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/cufee/am-clanactivity/config"
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	mongo "github.com/cufee/am-clanactivity/mongoapi"
+	"github.com/cufee/am-clanactivity/store/bolt"
+)
+
+func main() {
+	configPath := flag.String("config", "config.json", "path to JSON config file")
+	realmFlag := flag.String("realm", "NA", "realm for clans that do not have one, and for records without a known clan or player")
+	flag.Parse()
+
+	cfg, err := config.Read(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.ValidateStorage(); err != nil {
+		log.Fatal(err)
+	}
+	realm, err := wgapi.ParseRealm(*realmFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var migrated map[string]int
+	switch cfg.Storage.Backend {
+	case config.BackendMongo:
+		db, err := mongo.New(cfg.Mongo)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close(context.Background())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		migrated, err = db.MigrateRealmKeys(ctx, string(realm))
+		if err != nil {
+			log.Fatal(err)
+		}
+	case config.BackendBolt:
+		db, err := bolt.New(cfg.Storage.BoltPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close(context.Background())
+
+		migrated, err = db.MigrateRealmKeys(string(realm))
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Println("Nothing to migrate for the", cfg.Storage.Backend, "backend")
+		return
+	}
+	names := make([]string, 0, len(migrated))
+	for name := range migrated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Printf("Migrated %d %s records to realm keys", migrated[name], name)
+	}
+}
@@ -1,12 +1,529 @@
 package config
 
-// wargaming
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
-// WgAPIAppID - WG Application ID for Wargaming API
-const WgAPIAppID string = "add73e99679dd4b7d1ed7218fe0be448"
+// Duration - time.Duration that can be read from a JSON string like "10s"
+type Duration time.Duration
 
+// UnmarshalJSON - Parse a duration string or a number of nanoseconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case float64:
+		*d = Duration(time.Duration(v))
+		return nil
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+		return nil
+	default:
+		return fmt.Errorf("invalid duration %s", string(data))
+	}
+}
 
-// mongoapi
+// MarshalJSON - Write duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
 
-//MongoURI - URI for connecting to MongoDB
-const MongoURI string = "mongodb://51.222.13.110:27017"
\ No newline at end of file
+// Std - Convert to time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// Config - Application configuration
+type Config struct {
+	Wargaming  WargamingConfig  `json:"wargaming"`
+	Storage    StorageConfig    `json:"storage"`
+	Mongo      MongoConfig      `json:"mongo"`
+	Server     ServerConfig     `json:"server"`
+	Processing ProcessingConfig `json:"processing"`
+	Scheduler  SchedulerConfig  `json:"scheduler"`
+}
+
+// WargamingConfig - Wargaming API settings
+type WargamingConfig struct {
+	// AppID - Wargaming developer application ID, usually set through CLANACTIVITY_WG_APP_ID instead of the file
+	AppID   string            `json:"app_id"`
+	Domains map[string]string `json:"domains"`
+	Timeout Duration          `json:"timeout"`
+	Retry   RetryConfig       `json:"retry"`
+	// RequestsPerSecond - Rate limit per realm, shared by every caller
+	RequestsPerSecond map[string]float64 `json:"requests_per_second"`
+}
+
+// RetryConfig - Retry settings for failed Wargaming API requests
+type RetryConfig struct {
+	MaxAttempts  int      `json:"max_attempts"`
+	BaseDelay    Duration `json:"base_delay"`
+	MaxDelay     Duration `json:"max_delay"`
+	Budget       float64  `json:"budget"`
+	BudgetRefill float64  `json:"budget_refill"`
+}
+
+// Storage backends
+const (
+	BackendMongo  = "mongo"
+	BackendMemory = "memory"
+	BackendBolt   = "bolt"
+)
+
+// StorageConfig - Storage backend selection
+type StorageConfig struct {
+	Backend string `json:"backend"`
+	// BoltPath - Database file used by the bolt backend
+	BoltPath string `json:"bolt_path"`
+	// TankAveragesFile - JSON array of tank averages to seed the memory backend with
+	TankAveragesFile string `json:"tank_averages_file"`
+}
+
+// MongoConfig - MongoDB connection settings
+type MongoConfig struct {
+	URI              string   `json:"uri"`
+	Database         string   `json:"database"`
+	GlossaryDatabase string   `json:"glossary_database"`
+	ConnectTimeout   Duration `json:"connect_timeout"`
+}
+
+// ServerConfig - HTTP server settings
+type ServerConfig struct {
+	ListenAddr   string   `json:"listen_addr"`
+	ReadTimeout  Duration `json:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout"`
+	// ShutdownTimeout - How long in-flight requests and jobs get to finish after SIGINT or SIGTERM
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+}
+
+// ProcessingConfig - Limits for clan and player processing
+type ProcessingConfig struct {
+	MaxConcurrentPlayers int `json:"max_concurrent_players"`
+	// MaxConcurrentVehicles - Vehicle ratings calculated at the same time across all players
+	MaxConcurrentVehicles int `json:"max_concurrent_vehicles"`
+	// TankAveragesRefresh - How often the tank averages cache is reloaded
+	TankAveragesRefresh Duration `json:"tank_averages_refresh"`
+	// RollupInterval - How often daily activity rollups are recomputed for the current and previous day
+	RollupInterval Duration `json:"rollup_interval"`
+	// JobWorkers - How many enrollment, reset and refresh jobs run at the same time
+	JobWorkers int `json:"job_workers"`
+}
+
+// SchedulerConfig - Background roster sync and session refresh of enrolled clans
+type SchedulerConfig struct {
+	Enabled bool `json:"enabled"`
+	// Interval - How often each clan is refreshed, clans are spread evenly across it
+	Interval Duration `json:"interval"`
+}
+
+// Default - Config with all non-secret values set
+func Default() Config {
+	return Config{
+		Wargaming: WargamingConfig{
+			Domains: map[string]string{
+				"NA":   "http://api.wotblitz.com",
+				"EU":   "http://api.wotblitz.eu",
+				"RU":   "http://api.wotblitz.ru",
+				"ASIA": "http://api.wotblitz.asia",
+			},
+			Timeout: Duration(10 * time.Second),
+			Retry: RetryConfig{
+				MaxAttempts:  4,
+				BaseDelay:    Duration(250 * time.Millisecond),
+				MaxDelay:     Duration(5 * time.Second),
+				Budget:       20,
+				BudgetRefill: 0.1,
+			},
+			RequestsPerSecond: map[string]float64{
+				"NA":   10,
+				"EU":   10,
+				"RU":   10,
+				"ASIA": 10,
+			},
+		},
+		Storage: StorageConfig{
+			Backend:  BackendMongo,
+			BoltPath: "clanactivity.db",
+		},
+		Mongo: MongoConfig{
+			Database:         "clan_activity",
+			GlossaryDatabase: "glossary",
+			ConnectTimeout:   Duration(10 * time.Second),
+		},
+		Server: ServerConfig{
+			ListenAddr:      ":10000",
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Processing: ProcessingConfig{
+			MaxConcurrentPlayers:  15,
+			MaxConcurrentVehicles: 4,
+			TankAveragesRefresh:   Duration(6 * time.Hour),
+			RollupInterval:        Duration(time.Hour),
+			JobWorkers:            2,
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:  true,
+			Interval: Duration(time.Hour),
+		},
+	}
+}
+
+// Load - Load config from a JSON file and apply environment overrides, then validate all of it
+// A missing file is not an error, defaults and environment are used instead
+func Load(path string) (Config, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Read - Load config like Load without validating it, for tools that only use some of the sections
+func Read(path string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return cfg, fmt.Errorf("config: reading %s: %v", path, err)
+		}
+		if err == nil {
+			// Realms from the file are layered over the defaults once their names are canonical
+			defaults := cfg.Wargaming
+			cfg.Wargaming.Domains, cfg.Wargaming.RequestsPerSecond = nil, nil
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return cfg, fmt.Errorf("config: parsing %s: %v", path, err)
+			}
+			if err := cfg.Wargaming.mergeRealms(defaults); err != nil {
+				return cfg, fmt.Errorf("config: parsing %s: %v", path, err)
+			}
+		}
+	}
+	return cfg, cfg.applyEnv(os.LookupEnv)
+}
+
+// realmAliases - Realm names accepted besides the canonical ones, matching wargaming.ParseRealm
+var realmAliases = map[string]string{"AS": "ASIA"}
+
+// canonicalRealm - Uppercase realm name with aliases resolved
+func canonicalRealm(name string) string {
+	name = strings.ToUpper(name)
+	if canonical, ok := realmAliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// mergeRealms - Layer domains and rates of c over defaults under canonical realm names, so an alias replaces the default of its realm
+func (c *WargamingConfig) mergeRealms(defaults WargamingConfig) error {
+	var errs []string
+
+	domains := make(map[string]string, len(defaults.Domains))
+	for realm, domain := range defaults.Domains {
+		domains[realm] = domain
+	}
+	seen := make(map[string]string)
+	for name, domain := range c.Domains {
+		realm := canonicalRealm(name)
+		if prev, ok := seen[realm]; ok {
+			errs = append(errs, fmt.Sprintf("wargaming.domains: %s and %s both configure realm %s", prev, name, realm))
+		}
+		seen[realm] = name
+		domains[realm] = domain
+	}
+
+	rates := make(map[string]float64, len(defaults.RequestsPerSecond))
+	for realm, rps := range defaults.RequestsPerSecond {
+		rates[realm] = rps
+	}
+	seen = make(map[string]string)
+	for name, rps := range c.RequestsPerSecond {
+		realm := canonicalRealm(name)
+		if prev, ok := seen[realm]; ok {
+			errs = append(errs, fmt.Sprintf("wargaming.requests_per_second: %s and %s both configure realm %s", prev, name, realm))
+		}
+		seen[realm] = name
+		rates[realm] = rps
+	}
+
+	c.Domains, c.RequestsPerSecond = domains, rates
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// envPrefix - Prefix for all environment overrides
+const envPrefix = "CLANACTIVITY_"
+
+// applyEnv - Override config values from environment variables
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []string
+
+	str := func(key string, target *string) {
+		if v, ok := lookup(envPrefix + key); ok {
+			*target = v
+		}
+	}
+	dur := func(key string, target *Duration) {
+		if v, ok := lookup(envPrefix + key); ok {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s%s: %v", envPrefix, key, err))
+				return
+			}
+			*target = Duration(parsed)
+		}
+	}
+	num := func(key string, target *int) {
+		if v, ok := lookup(envPrefix + key); ok {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s%s: %v", envPrefix, key, err))
+				return
+			}
+			*target = parsed
+		}
+	}
+	boolean := func(key string, target *bool) {
+		if v, ok := lookup(envPrefix + key); ok {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s%s: %v", envPrefix, key, err))
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	str("WG_APP_ID", &c.Wargaming.AppID)
+	dur("WG_TIMEOUT", &c.Wargaming.Timeout)
+	num("WG_RETRY_MAX_ATTEMPTS", &c.Wargaming.Retry.MaxAttempts)
+	for _, realm := range []string{"NA", "EU", "RU", "ASIA"} {
+		if v, ok := lookup(envPrefix + "WG_DOMAIN_" + realm); ok {
+			if c.Wargaming.Domains == nil {
+				c.Wargaming.Domains = make(map[string]string)
+			}
+			c.Wargaming.Domains[realm] = v
+		}
+		if v, ok := lookup(envPrefix + "WG_RPS_" + realm); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%sWG_RPS_%s: %v", envPrefix, realm, err))
+				continue
+			}
+			if c.Wargaming.RequestsPerSecond == nil {
+				c.Wargaming.RequestsPerSecond = make(map[string]float64)
+			}
+			c.Wargaming.RequestsPerSecond[realm] = parsed
+		}
+	}
+
+	str("STORAGE_BACKEND", &c.Storage.Backend)
+	str("BOLT_PATH", &c.Storage.BoltPath)
+	str("TANK_AVERAGES_FILE", &c.Storage.TankAveragesFile)
+
+	str("MONGO_URI", &c.Mongo.URI)
+	str("MONGO_DATABASE", &c.Mongo.Database)
+	str("MONGO_GLOSSARY_DATABASE", &c.Mongo.GlossaryDatabase)
+	dur("MONGO_CONNECT_TIMEOUT", &c.Mongo.ConnectTimeout)
+
+	str("LISTEN_ADDR", &c.Server.ListenAddr)
+	dur("READ_TIMEOUT", &c.Server.ReadTimeout)
+	dur("WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	dur("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+
+	num("MAX_CONCURRENT_PLAYERS", &c.Processing.MaxConcurrentPlayers)
+	num("MAX_CONCURRENT_VEHICLES", &c.Processing.MaxConcurrentVehicles)
+	dur("TANK_AVERAGES_REFRESH", &c.Processing.TankAveragesRefresh)
+	dur("ROLLUP_INTERVAL", &c.Processing.RollupInterval)
+	num("JOB_WORKERS", &c.Processing.JobWorkers)
+
+	boolean("SCHEDULER_ENABLED", &c.Scheduler.Enabled)
+	dur("SCHEDULER_INTERVAL", &c.Scheduler.Interval)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: invalid environment: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Validate - Check that all required values are set and sane
+func (c Config) Validate() error {
+	var errs []string
+
+	if c.Wargaming.AppID == "" {
+		errs = append(errs, "wargaming.app_id is required")
+	}
+	if c.Wargaming.Timeout <= 0 {
+		errs = append(errs, "wargaming.timeout must be positive")
+	}
+	if c.Wargaming.Retry.MaxAttempts < 1 {
+		errs = append(errs, "wargaming.retry.max_attempts must be at least 1")
+	}
+	if c.Wargaming.Retry.BaseDelay <= 0 || c.Wargaming.Retry.MaxDelay < c.Wargaming.Retry.BaseDelay {
+		errs = append(errs, "wargaming.retry.base_delay must be positive and not above max_delay")
+	}
+	if c.Wargaming.Retry.Budget < 0 || c.Wargaming.Retry.BudgetRefill < 0 {
+		errs = append(errs, "wargaming.retry budget values can not be negative")
+	}
+	if len(c.Wargaming.Domains) == 0 {
+		errs = append(errs, "wargaming.domains must list at least one realm")
+	}
+	domainRealms := make(map[string]bool, len(c.Wargaming.Domains))
+	for realm, domain := range c.Wargaming.Domains {
+		domainRealms[canonicalRealm(realm)] = true
+		switch canonicalRealm(realm) {
+		case "NA", "EU", "RU", "ASIA":
+		default:
+			errs = append(errs, fmt.Sprintf("wargaming.domains.%s is not a known realm", realm))
+		}
+		if u, err := url.Parse(domain); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("wargaming.domains.%s is not a valid URL", realm))
+		}
+	}
+
+	for realm, rps := range c.Wargaming.RequestsPerSecond {
+		if !domainRealms[canonicalRealm(realm)] {
+			errs = append(errs, fmt.Sprintf("wargaming.requests_per_second.%s has no matching domain", realm))
+		}
+		if rps <= 0 {
+			errs = append(errs, fmt.Sprintf("wargaming.requests_per_second.%s must be positive", realm))
+		}
+	}
+
+	errs = append(errs, c.validateStorage()...)
+
+	if c.Server.ListenAddr == "" {
+		errs = append(errs, "server.listen_addr is required")
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 {
+		errs = append(errs, "server timeouts can not be negative")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, "server.shutdown_timeout must be positive")
+	}
+
+	if c.Processing.MaxConcurrentPlayers < 1 {
+		errs = append(errs, "processing.max_concurrent_players must be at least 1")
+	}
+	if c.Processing.MaxConcurrentVehicles < 1 {
+		errs = append(errs, "processing.max_concurrent_vehicles must be at least 1")
+	}
+	if c.Processing.TankAveragesRefresh <= 0 {
+		errs = append(errs, "processing.tank_averages_refresh must be positive")
+	}
+	if c.Processing.RollupInterval <= 0 {
+		errs = append(errs, "processing.rollup_interval must be positive")
+	}
+	if c.Processing.JobWorkers < 1 {
+		errs = append(errs, "processing.job_workers must be at least 1")
+	}
+	if c.Scheduler.Interval <= 0 {
+		errs = append(errs, "scheduler.interval must be positive")
+	}
+
+	if len(errs) > 0 {
+		return errors.New("config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ValidateStorage - Check only the storage section and the settings of the selected backend, for tools that do not call Wargaming or serve requests
+func (c Config) ValidateStorage() error {
+	if errs := c.validateStorage(); len(errs) > 0 {
+		return errors.New("config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validateStorage - Check the storage section and the settings of the selected backend
+func (c Config) validateStorage() []string {
+	var errs []string
+	switch c.Storage.Backend {
+	case BackendMongo:
+		errs = append(errs, c.Mongo.validate()...)
+	case BackendMemory:
+	case BackendBolt:
+		if c.Storage.BoltPath == "" {
+			errs = append(errs, "storage.bolt_path is required")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("storage.backend %q is not one of %s, %s, %s", c.Storage.Backend, BackendMongo, BackendMemory, BackendBolt))
+	}
+	return errs
+}
+
+// Validate - Check MongoDB settings, for tools that need Mongo regardless of the selected backend
+func (c MongoConfig) Validate() error {
+	if errs := c.validate(); len(errs) > 0 {
+		return errors.New("config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validate - Check MongoDB settings
+func (c MongoConfig) validate() []string {
+	var errs []string
+	if c.URI == "" {
+		errs = append(errs, "mongo.uri is required")
+	} else if !strings.HasPrefix(c.URI, "mongodb://") && !strings.HasPrefix(c.URI, "mongodb+srv://") {
+		errs = append(errs, "mongo.uri must start with mongodb:// or mongodb+srv://")
+	}
+	if c.Database == "" {
+		errs = append(errs, "mongo.database is required")
+	}
+	if c.GlossaryDatabase == "" {
+		errs = append(errs, "mongo.glossary_database is required")
+	}
+	if c.ConnectTimeout <= 0 {
+		errs = append(errs, "mongo.connect_timeout must be positive")
+	}
+	return errs
+}
+
+// Redacted - Copy of the config that is safe to log
+func (c Config) Redacted() Config {
+	r := c
+	if r.Wargaming.AppID != "" {
+		r.Wargaming.AppID = "redacted"
+	}
+	r.Mongo.URI = redactURI(r.Mongo.URI)
+	return r
+}
+
+// String - JSON representation with secrets removed
+func (c Config) String() string {
+	data, _ := json.Marshal(c.Redacted())
+	return string(data)
+}
+
+// redactURI - Strip credentials from a connection URI
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		if uri == "" {
+			return ""
+		}
+		return "redacted"
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	return u.String()
+}
@@ -1,21 +1,36 @@
 package externalapis
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
-	"time"
 )
 
-// Global HTTP client
-var clientHTTP = &http.Client{Timeout: 10 * time.Second}
+// HTTPError - Returned by GetJSON when the server responds with a non-2xx status
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected response status %s", e.Status)
+}
 
 // GetJSON - Send a GET request to URL and return JSON result into target interface
-func GetJSON(url string, target interface{}) error {
-	r, err := clientHTTP.Get(url)
+func GetJSON(ctx context.Context, client *http.Client, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	r, err := client.Do(req)
 	// log.Println(url, "-", r.Status)
 	if err != nil {
 		return err
 	}
 	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return &HTTPError{StatusCode: r.StatusCode, Status: r.Status}
+	}
 	return json.NewDecoder(r.Body).Decode(target)
 }
@@ -0,0 +1,211 @@
+package externalapis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/cufee/am-clanactivity/config"
+	utils "github.com/cufee/am-clanactivity/externalapis/utils"
+)
+
+// Realm - Wargaming server region
+type Realm string
+
+// Supported realms
+const (
+	RealmNA   Realm = "NA"
+	RealmEU   Realm = "EU"
+	RealmRU   Realm = "RU"
+	RealmASIA Realm = "ASIA"
+)
+
+// ParseRealm - Parse a realm name, case-insensitive, AS is accepted for ASIA
+func ParseRealm(realm string) (Realm, error) {
+	switch strings.ToUpper(strings.TrimSpace(realm)) {
+	case "NA":
+		return RealmNA, nil
+	case "EU":
+		return RealmEU, nil
+	case "RU":
+		return RealmRU, nil
+	case "ASIA", "AS":
+		return RealmASIA, nil
+	default:
+		return "", fmt.Errorf("realm %s not found", realm)
+	}
+}
+
+// Client - Wargaming API client
+type Client struct {
+	appID    string
+	http     *http.Client
+	baseURLs map[Realm]string
+	retry    RetryPolicy
+	budget   *retryBudget
+
+	limitersMu sync.RWMutex
+	limiters   map[Realm]*rateLimiter
+}
+
+// NewClient - Create a new client, baseURLs maps each realm to an API root like http://api.wotblitz.com
+func NewClient(appID string, httpClient *http.Client, baseURLs map[Realm]string) *Client {
+	urls := make(map[Realm]string, len(baseURLs))
+	limiters := make(map[Realm]*rateLimiter, len(baseURLs))
+	for realm, base := range baseURLs {
+		urls[realm] = strings.TrimRight(base, "/")
+		limiters[realm] = newRateLimiter(DefaultRequestsPerSecond)
+	}
+	return &Client{
+		appID:    appID,
+		http:     httpClient,
+		baseURLs: urls,
+		retry:    DefaultRetryPolicy,
+		budget:   newRetryBudget(DefaultRetryPolicy),
+		limiters: limiters,
+	}
+}
+
+// SetRateLimit - Set requests per second for a realm, requests already waiting keep the old limiter
+func (c *Client) SetRateLimit(realm Realm, rps float64) {
+	c.limitersMu.Lock()
+	defer c.limitersMu.Unlock()
+	c.limiters[realm] = newRateLimiter(rps)
+}
+
+// limiter - Rate limiter of a realm
+func (c *Client) limiter(realm Realm) *rateLimiter {
+	c.limitersMu.RLock()
+	defer c.limitersMu.RUnlock()
+	return c.limiters[realm]
+}
+
+// LimiterStats - Rate limiter stats for every configured realm
+func (c *Client) LimiterStats() map[Realm]LimiterStats {
+	c.limitersMu.RLock()
+	defer c.limitersMu.RUnlock()
+
+	stats := make(map[Realm]LimiterStats, len(c.limiters))
+	for realm, limiter := range c.limiters {
+		stats[realm] = limiter.Stats()
+	}
+	return stats
+}
+
+// SetRetryPolicy - Replace the retry policy and reset the retry budget
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	c.retry = policy
+	c.budget = newRetryBudget(policy)
+}
+
+// NewClientFromConfig - Create a new client from Wargaming config
+func NewClientFromConfig(cfg config.WargamingConfig) (*Client, error) {
+	// Aliases like AS and ASIA parse to the same realm, so each realm is only allowed once
+	baseURLs := make(map[Realm]string, len(cfg.Domains))
+	domainNames := make(map[Realm]string, len(cfg.Domains))
+	for name, domain := range cfg.Domains {
+		realm, err := ParseRealm(name)
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := domainNames[realm]; ok {
+			return nil, fmt.Errorf("wargaming.domains: %s and %s both configure realm %s", prev, name, realm)
+		}
+		domainNames[realm] = name
+		baseURLs[realm] = domain
+	}
+	rates := make(map[Realm]float64, len(cfg.RequestsPerSecond))
+	rateNames := make(map[Realm]string, len(cfg.RequestsPerSecond))
+	for name, rps := range cfg.RequestsPerSecond {
+		realm, err := ParseRealm(name)
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := rateNames[realm]; ok {
+			return nil, fmt.Errorf("wargaming.requests_per_second: %s and %s both configure realm %s", prev, name, realm)
+		}
+		rateNames[realm] = name
+		rates[realm] = rps
+	}
+	client := NewClient(cfg.AppID, &http.Client{Timeout: cfg.Timeout.Std()}, baseURLs)
+	client.SetRetryPolicy(RetryPolicy{
+		MaxAttempts:  cfg.Retry.MaxAttempts,
+		BaseDelay:    cfg.Retry.BaseDelay.Std(),
+		MaxDelay:     cfg.Retry.MaxDelay.Std(),
+		Budget:       cfg.Retry.Budget,
+		BudgetRefill: cfg.Retry.BudgetRefill,
+	})
+	for realm, rps := range rates {
+		client.SetRateLimit(realm, rps)
+	}
+	return client, nil
+}
+
+// endpointURL - Build a full request URL for realm, path and query
+func (c *Client) endpointURL(realm Realm, path string, query url.Values) (string, error) {
+	base, ok := c.baseURLs[realm]
+	if !ok {
+		return "", fmt.Errorf("realm %s is not configured", realm)
+	}
+	params := url.Values{}
+	for key, values := range query {
+		params[key] = values
+	}
+	params.Set("application_id", c.appID)
+	return base + path + "?" + params.Encode(), nil
+}
+
+// getJSON - Send a GET request to an API endpoint and decode the response into target
+// Retryable errors are retried according to the client retry policy
+func (c *Client) getJSON(ctx context.Context, realm Realm, path string, query url.Values, target interface{}) error {
+	fullURL, err := c.endpointURL(realm, path, query)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter(realm).Wait(ctx); err != nil {
+			return err
+		}
+		err = c.getEnvelope(ctx, fullURL, target)
+		if err == nil {
+			c.budget.deposit()
+			return nil
+		}
+		if !isRetryable(err) || attempt+1 >= c.retry.MaxAttempts || !c.budget.withdraw() {
+			return err
+		}
+		delay := c.retry.backoff(attempt)
+		log.Printf("Retrying %s on %s in %v: %v", path, realm, delay, err)
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// getEnvelope - Send a single request, check the response status envelope and decode it into target
+func (c *Client) getEnvelope(ctx context.Context, fullURL string, target interface{}) error {
+	var raw json.RawMessage
+	if err := utils.GetJSON(ctx, c.http, fullURL, &raw); err != nil {
+		return err
+	}
+	var status envelope
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return err
+	}
+	if status.Status == "error" {
+		if status.Error == nil {
+			return &APIError{Message: "UNKNOWN_ERROR"}
+		}
+		return status.Error
+	}
+	return json.Unmarshal(raw, target)
+}
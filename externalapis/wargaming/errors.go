@@ -0,0 +1,71 @@
+package externalapis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	utils "github.com/cufee/am-clanactivity/externalapis/utils"
+)
+
+// Errors returned by the Wargaming API, match with errors.Is
+var (
+	ErrRequestLimitExceeded = errors.New("wargaming: request limit exceeded")
+	ErrInvalidApplicationID = errors.New("wargaming: invalid application id")
+	ErrAccountNotFound      = errors.New("wargaming: account not found")
+	ErrSourceNotAvailable   = errors.New("wargaming: source not available")
+)
+
+// APIError - Error envelope returned by the Wargaming API with status "error"
+type APIError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Field   string      `json:"field"`
+	Value   interface{} `json:"value"`
+}
+
+func (e *APIError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("wargaming: %s (code %d, field %s, value %v)", e.Message, e.Code, e.Field, e.Value)
+	}
+	return fmt.Sprintf("wargaming: %s (code %d)", e.Message, e.Code)
+}
+
+// Is - Match the error message to one of the sentinel errors
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrRequestLimitExceeded:
+		return e.Message == "REQUEST_LIMIT_EXCEEDED"
+	case ErrInvalidApplicationID:
+		return e.Message == "INVALID_APPLICATION_ID" || e.Message == "APPLICATION_IS_BLOCKED"
+	case ErrAccountNotFound:
+		return e.Field == "account_id" && e.Message == "INVALID_ACCOUNT_ID"
+	case ErrSourceNotAvailable:
+		return e.Message == "SOURCE_NOT_AVAILABLE"
+	}
+	return false
+}
+
+// envelope - Status part of every Wargaming API response
+type envelope struct {
+	Status string    `json:"status"`
+	Error  *APIError `json:"error"`
+}
+
+// isRetryable - Check if a failed request is worth retrying
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrRequestLimitExceeded) || errors.Is(err, ErrSourceNotAvailable) {
+		return true
+	}
+	var httpErr *utils.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
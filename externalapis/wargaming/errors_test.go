@@ -0,0 +1,132 @@
+package externalapis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	utils "github.com/cufee/am-clanactivity/externalapis/utils"
+)
+
+// newTestClient - Client for RealmNA pointed at handler, retrying up to attempts times without real delays
+func newTestClient(t *testing.T, attempts int, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := NewClient("app", server.Client(), map[Realm]string{RealmNA: server.URL})
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: attempts, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Budget: 100})
+	client.SetRateLimit(RealmNA, 1000)
+	return client
+}
+
+func TestEnvelopeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"request limit", http.StatusOK, `{"status":"error","error":{"code":407,"message":"REQUEST_LIMIT_EXCEEDED"}}`, ErrRequestLimitExceeded},
+		{"invalid application id", http.StatusOK, `{"status":"error","error":{"code":407,"message":"INVALID_APPLICATION_ID","field":"application_id"}}`, ErrInvalidApplicationID},
+		{"blocked application", http.StatusOK, `{"status":"error","error":{"code":407,"message":"APPLICATION_IS_BLOCKED"}}`, ErrInvalidApplicationID},
+		{"invalid account", http.StatusOK, `{"status":"error","error":{"code":407,"message":"INVALID_ACCOUNT_ID","field":"account_id","value":"x"}}`, ErrAccountNotFound},
+		{"source not available", http.StatusOK, `{"status":"error","error":{"code":504,"message":"SOURCE_NOT_AVAILABLE"}}`, ErrSourceNotAvailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, 1, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			_, err := client.GetVehicleStats(context.Background(), RealmNA, 1001)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetVehicleStats() error = %v, want %v", err, tt.want)
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Errorf("GetVehicleStats() error = %T, want *APIError", err)
+			}
+		})
+	}
+}
+
+func TestEnvelopeWithoutError(t *testing.T) {
+	client := newTestClient(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"error"}`)
+	})
+	_, err := client.GetVehicleStats(context.Background(), RealmNA, 1001)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "UNKNOWN_ERROR" {
+		t.Errorf("GetVehicleStats() error = %v, want UNKNOWN_ERROR", err)
+	}
+	if errors.Is(err, ErrAccountNotFound) || errors.Is(err, ErrRequestLimitExceeded) {
+		t.Errorf("GetVehicleStats() error = %v matches a sentinel error", err)
+	}
+}
+
+func TestHTTPStatusError(t *testing.T) {
+	client := newTestClient(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	_, err := client.GetVehicleStats(context.Background(), RealmNA, 1001)
+	var httpErr *utils.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("GetVehicleStats() error = %v, want HTTP 502", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"request limit", &APIError{Message: "REQUEST_LIMIT_EXCEEDED"}, true},
+		{"source not available", fmt.Errorf("wrapped: %w", &APIError{Message: "SOURCE_NOT_AVAILABLE"}), true},
+		{"invalid application id", &APIError{Message: "INVALID_APPLICATION_ID"}, false},
+		{"invalid account", &APIError{Message: "INVALID_ACCOUNT_ID", Field: "account_id"}, false},
+		{"too many requests", &utils.HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", &utils.HTTPError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"not found", &utils.HTTPError{StatusCode: http.StatusNotFound}, false},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("request: %w", context.DeadlineExceeded), false},
+		{"decoding", errors.New("invalid character"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNullData(t *testing.T) {
+	client := newTestClient(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("account_id") {
+		case "1001":
+			// Account exists without any data
+			fmt.Fprint(w, `{"status":"ok","data":{"1001":null}}`)
+		default:
+			fmt.Fprint(w, `{"status":"ok","data":{}}`)
+		}
+	})
+	ctx := context.Background()
+
+	vehicles, err := client.GetVehicleStats(ctx, RealmNA, 1001)
+	if err != nil || vehicles == nil || len(vehicles) != 0 {
+		t.Errorf("GetVehicleStats() with null data = %v, %v, want no vehicles", vehicles, err)
+	}
+	if _, err := client.GetVehicleStats(ctx, RealmNA, 1002); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("GetVehicleStats() of a missing account error = %v, want ErrAccountNotFound", err)
+	}
+	if _, err := client.GetPlayerDataByID(ctx, RealmNA, 1001); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("GetPlayerDataByID() with null data error = %v, want ErrAccountNotFound", err)
+	}
+}
@@ -0,0 +1,98 @@
+package externalapis
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultRequestsPerSecond - Per-realm request rate used by NewClient
+const DefaultRequestsPerSecond = 10
+
+// LimiterStats - Snapshot of a realm rate limiter
+type LimiterStats struct {
+	RequestsPerSecond float64       `json:"requests_per_second"`
+	QueueDepth        int           `json:"queue_depth"`
+	Requests          uint64        `json:"requests"`
+	Delayed           uint64        `json:"delayed"`
+	TotalWait         time.Duration `json:"total_wait_ns"`
+	MaxWait           time.Duration `json:"max_wait_ns"`
+	AverageWait       time.Duration `json:"average_wait_ns"`
+}
+
+// rateLimiter - Token bucket shared by all requests to one realm
+// Callers reserve a token up front and sleep until it is due, so requests are served in order
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	queue     int
+	requests  uint64
+	delayed   uint64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+func newRateLimiter(rps float64) *rateLimiter {
+	burst := math.Max(1, math.Ceil(rps))
+	return &rateLimiter{rate: rps, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait - Block until a request is allowed or ctx is done
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	l.requests++
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		l.queue++
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	err := sleepContext(ctx, delay)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queue--
+	if err != nil {
+		// Give the reserved token back to callers still waiting
+		l.tokens++
+		return err
+	}
+	l.delayed++
+	l.totalWait += delay
+	if delay > l.maxWait {
+		l.maxWait = delay
+	}
+	return nil
+}
+
+// Stats - Current limiter counters
+func (l *rateLimiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := LimiterStats{
+		RequestsPerSecond: l.rate,
+		QueueDepth:        l.queue,
+		Requests:          l.requests,
+		Delayed:           l.delayed,
+		TotalWait:         l.totalWait,
+		MaxWait:           l.maxWait,
+	}
+	if l.delayed > 0 {
+		stats.AverageWait = l.totalWait / time.Duration(l.delayed)
+	}
+	return stats
+}
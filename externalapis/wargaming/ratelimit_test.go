@@ -0,0 +1,106 @@
+package externalapis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// canceled - Context that is already done, Wait only succeeds with it when no delay is needed
+func canceled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+// immediate - Count the requests the limiter allows right away, up to max
+func immediate(l *rateLimiter, max int) int {
+	for i := 0; i < max; i++ {
+		if l.Wait(canceled()) != nil {
+			return i
+		}
+	}
+	return max
+}
+
+// rewind - Pretend elapsed passed since the limiter was last used
+func rewind(l *rateLimiter, elapsed time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.last = l.last.Add(-elapsed)
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	tests := []struct {
+		name string
+		rps  float64
+		want int
+	}{
+		{"whole rate", 5, 5},
+		{"fractional rate rounds up", 2.5, 3},
+		{"below one per second", 0.5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.rps)
+			if got := immediate(l, 100); got != tt.want {
+				t.Errorf("limiter at %v rps allowed a burst of %d, want %d", tt.rps, got, tt.want)
+			}
+			// Canceled waits give their token back, so nothing is allowed after the burst either
+			if got := immediate(l, 100); got != 0 {
+				t.Errorf("limiter allowed %d more after the burst, want 0", got)
+			}
+		})
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := newRateLimiter(10)
+	immediate(l, 100)
+
+	rewind(l, 300*time.Millisecond)
+	if got := immediate(l, 100); got != 3 {
+		t.Errorf("limiter allowed %d after 300ms at 10 rps, want 3", got)
+	}
+	// Refill stops at the burst size
+	rewind(l, time.Minute)
+	if got := immediate(l, 100); got != 10 {
+		t.Errorf("limiter allowed %d after a minute at 10 rps, want a burst of 10", got)
+	}
+}
+
+func TestRateLimiterDelay(t *testing.T) {
+	l := newRateLimiter(50)
+	immediate(l, 100)
+
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if waited := time.Since(start); waited < 15*time.Millisecond {
+		t.Errorf("Wait() after the burst returned in %v, want about 20ms", waited)
+	}
+	// The burst, the canceled wait that ended it and the delayed one
+	stats := l.Stats()
+	if stats.Requests != 52 || stats.Delayed != 1 || stats.MaxWait <= 0 || stats.MaxWait > 20*time.Millisecond || stats.QueueDepth != 0 {
+		t.Errorf("Stats() = %+v, want 52 requests with one delayed by up to 20ms", stats)
+	}
+}
+
+func TestRateLimiterRealms(t *testing.T) {
+	client := NewClient("app", nil, map[Realm]string{RealmNA: "http://na.test", RealmEU: "http://eu.test"})
+	client.SetRateLimit(RealmNA, 2)
+	client.SetRateLimit(RealmEU, 2)
+
+	if got := immediate(client.limiter(RealmNA), 100); got != 2 {
+		t.Fatalf("NA limiter allowed %d, want 2", got)
+	}
+	// Spending the NA budget leaves EU untouched
+	if got := immediate(client.limiter(RealmEU), 100); got != 2 {
+		t.Errorf("EU limiter allowed %d after NA was used up, want 2", got)
+	}
+	stats := client.LimiterStats()
+	if len(stats) != 2 || stats[RealmNA].RequestsPerSecond != 2 || stats[RealmEU].RequestsPerSecond != 2 {
+		t.Errorf("LimiterStats() = %+v, want one limiter per realm", stats)
+	}
+}
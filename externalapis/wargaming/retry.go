@@ -0,0 +1,87 @@
+package externalapis
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryPolicy - How failed requests with retryable errors are retried
+type RetryPolicy struct {
+	// MaxAttempts - Total attempts per request, including the first one
+	MaxAttempts int
+	// BaseDelay - Delay before the first retry, doubled on every attempt
+	BaseDelay time.Duration
+	// MaxDelay - Upper bound for a single delay
+	MaxDelay time.Duration
+	// Budget - Retries allowed across all requests before successful requests refill it
+	Budget float64
+	// BudgetRefill - Retry tokens returned to the budget on each successful request
+	BudgetRefill float64
+}
+
+// DefaultRetryPolicy - Retry policy used by NewClient
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  4,
+	BaseDelay:    250 * time.Millisecond,
+	MaxDelay:     5 * time.Second,
+	Budget:       20,
+	BudgetRefill: 0.1,
+}
+
+// backoff - Jittered exponential delay before retry number attempt, starting at 0
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << uint(attempt)
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	// Equal jitter, wait between half and the full delay
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryBudget - Shared token bucket that caps retries when the API is failing for everyone
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	max    float64
+	refill float64
+}
+
+func newRetryBudget(policy RetryPolicy) *retryBudget {
+	return &retryBudget{tokens: policy.Budget, max: policy.Budget, refill: policy.BudgetRefill}
+}
+
+// withdraw - Take a token for one retry, returns false if the budget is spent
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// deposit - Return part of a token after a successful request
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.refill
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+// sleepContext - Sleep for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
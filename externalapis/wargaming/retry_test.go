@@ -0,0 +1,125 @@
+package externalapis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingHandler - Respond with 503 to the first failures requests and with an empty vehicle list after, counting requests
+func failingHandler(failures int32, requests *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok","data":{"1001":[]}}`)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32
+		attempts int
+		wantErr  bool
+		want     int32
+	}{
+		{"first attempt", 0, 3, false, 1},
+		{"recovers", 2, 3, false, 3},
+		{"gives up", 5, 3, true, 3},
+		{"no retries", 1, 1, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			client := newTestClient(t, tt.attempts, failingHandler(tt.failures, &requests))
+			_, err := client.GetVehicleStats(context.Background(), RealmNA, 1001)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetVehicleStats() error = %v, want error %v", err, tt.wantErr)
+			}
+			if requests != tt.want {
+				t.Errorf("GetVehicleStats() sent %d requests, want %d", requests, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, 5, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, `{"status":"error","error":{"code":407,"message":"INVALID_APPLICATION_ID"}}`)
+	})
+	if _, err := client.GetVehicleStats(context.Background(), RealmNA, 1001); err == nil {
+		t.Error("GetVehicleStats() error = nil")
+	}
+	if requests != 1 {
+		t.Errorf("GetVehicleStats() sent %d requests, want 1", requests)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, 5, failingHandler(100, &requests))
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Budget: 2, BudgetRefill: 1})
+	ctx := context.Background()
+
+	// Two retries are left in the budget for the first request, none for the second
+	client.GetVehicleStats(ctx, RealmNA, 1001)
+	if requests != 3 {
+		t.Errorf("first request sent %d requests, want 3", requests)
+	}
+	client.GetVehicleStats(ctx, RealmNA, 1001)
+	if requests != 4 {
+		t.Errorf("second request sent %d requests, want 1 more", requests-3)
+	}
+}
+
+func TestRetryBudgetRefill(t *testing.T) {
+	budget := newRetryBudget(RetryPolicy{Budget: 2, BudgetRefill: 0.5})
+	if !budget.withdraw() || !budget.withdraw() {
+		t.Fatal("withdraw() = false with tokens left")
+	}
+	if budget.withdraw() {
+		t.Error("withdraw() = true with an empty budget")
+	}
+	budget.deposit()
+	if budget.withdraw() {
+		t.Error("withdraw() = true with half a token")
+	}
+	budget.deposit()
+	if !budget.withdraw() {
+		t.Error("withdraw() = false after two deposits")
+	}
+	for i := 0; i < 10; i++ {
+		budget.deposit()
+	}
+	if budget.tokens != 2 {
+		t.Errorf("budget tokens = %v, want capped at 2", budget.tokens)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		{100, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := policy.backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Errorf("backoff(%d) = %v, want between %v and %v", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
@@ -1,15 +1,13 @@
 package externalapis
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/cufee/am-clanactivity/config"
-	utils "github.com/cufee/am-clanactivity/externalapis/utils"
 )
 
 // ClanInfoRes - JSON response from WG API
@@ -38,9 +36,21 @@ type ClanDetails struct {
 	Members    map[string]PlayerRes `json:"members"`
 }
 
-// PlayerResRaw -
-type PlayerResRaw struct {
-	Data map[string]PlayerRes `json:"data"`
+// accountInfoRes - JSON response from WG account info API
+type accountInfoRes struct {
+	Data map[string]*AccountInfo `json:"data"`
+}
+
+// AccountInfo - Account data and total battles
+type AccountInfo struct {
+	ID             int    `json:"account_id"`
+	Nickname       string `json:"nickname"`
+	LastBattleTime int    `json:"last_battle_time"`
+	Statistics     struct {
+		All struct {
+			Battles int `json:"battles"`
+		} `json:"all"`
+	} `json:"statistics"`
 }
 
 // PlayerRes - player data response from WG
@@ -62,93 +72,90 @@ type playerVehiclesRes struct {
 
 // VehicleStats -
 type VehicleStats struct {
-	All struct {
-		Spotted              float64 `json:"spotted,omitempty"`
-		Hits                 float64 `json:"hits,omitempty"`
-		Frags                float64 `json:"frags,omitempty"`
-		MaxXp                int     `json:"max_xp,omitempty"`
-		Wins                 float64 `json:"wins,omitempty"`
-		Losses               float64 `json:"losses,omitempty"`
-		CapturePoints        float64 `json:"capture_points,omitempty"`
-		Battles              float64 `json:"battles,omitempty"`
-		DamageDealt          float64 `json:"damage_dealt,omitempty"`
-		DamageReceived       float64 `json:"damage_received,omitempty"`
-		MaxFrags             float64 `json:"max_frags,omitempty"`
-		Shots                float64 `json:"shots,omitempty"`
-		Xp                   float64 `json:"xp,omitempty"`
-		SurvivedBattles      float64 `json:"survived_battles,omitempty"`
-		DroppedCapturePoints float64 `json:"dropped_capture_points,omitempty"`
-	} `json:"all"`
-	LastBattleTime int `json:"last_battle_time,omitempty"`
-	MarkOfMastery  int `json:"mark_of_mastery,omitempty"`
-	TankID         int `json:"tank_id"`
-}
-
-// Players
-var wgAPIVehicles string = fmt.Sprintf("/wotb/tanks/stats/?application_id=%s&account_id=", config.WgAPIAppID)
-var wgAPIBaseStats string = fmt.Sprintf("/wotb/account/info/?application_id=%s&fields=statistics.all.battles&account_id=", config.WgAPIAppID)
-
-// Clans
-var wgAPIClanInfo string = fmt.Sprintf("/wotb/clans/list/?application_id=%s&search=", config.WgAPIAppID)
-var wgAPIClanDetails string = fmt.Sprintf("/wotb/clans/info/?application_id=%s&fields=clan_id,name,tag,is_clan_disbanded,members_ids,updated_at,members&extra=members&clan_id=", config.WgAPIAppID)
-
-// getAPIDomain - Get WG API domain using realm or playerID length
-func getAPIDomain(realm string) (string, error) {
-	realm = strings.ToUpper(realm)
-
-	if realm == "NA" {
-		return "http://api.wotblitz.com", nil
-
-	} else if realm == "EU" {
-		return "http://api.wotblitz.eu", nil
-
-	} else if realm == "RU" {
-		return "http://api.wotblitz.ru", nil
-
-	} else if realm == "ASIA" || realm == "AS" {
-		return "http://api.wotblitz.ru", nil
-
-	} else {
-		message := fmt.Sprintf("Realm %s not found", realm)
-		return "", errors.New(message)
+	All            BattleStats `json:"all"`
+	LastBattleTime int         `json:"last_battle_time,omitempty"`
+	MarkOfMastery  int         `json:"mark_of_mastery,omitempty"`
+	TankID         int         `json:"tank_id"`
+}
+
+// BattleStats - Totals for a vehicle
+type BattleStats struct {
+	Spotted              float64 `json:"spotted,omitempty"`
+	Hits                 float64 `json:"hits,omitempty"`
+	Frags                float64 `json:"frags,omitempty"`
+	MaxXp                int     `json:"max_xp,omitempty"`
+	Wins                 float64 `json:"wins,omitempty"`
+	Losses               float64 `json:"losses,omitempty"`
+	CapturePoints        float64 `json:"capture_points,omitempty"`
+	Battles              float64 `json:"battles,omitempty"`
+	DamageDealt          float64 `json:"damage_dealt,omitempty"`
+	DamageReceived       float64 `json:"damage_received,omitempty"`
+	MaxFrags             float64 `json:"max_frags,omitempty"`
+	Shots                float64 `json:"shots,omitempty"`
+	Xp                   float64 `json:"xp,omitempty"`
+	SurvivedBattles      float64 `json:"survived_battles,omitempty"`
+	DroppedCapturePoints float64 `json:"dropped_capture_points,omitempty"`
+}
+
+// Sub - Difference between two totals, max values are kept from s
+func (s BattleStats) Sub(o BattleStats) BattleStats {
+	return BattleStats{
+		Spotted:              s.Spotted - o.Spotted,
+		Hits:                 s.Hits - o.Hits,
+		Frags:                s.Frags - o.Frags,
+		MaxXp:                s.MaxXp,
+		Wins:                 s.Wins - o.Wins,
+		Losses:               s.Losses - o.Losses,
+		CapturePoints:        s.CapturePoints - o.CapturePoints,
+		Battles:              s.Battles - o.Battles,
+		DamageDealt:          s.DamageDealt - o.DamageDealt,
+		DamageReceived:       s.DamageReceived - o.DamageReceived,
+		MaxFrags:             s.MaxFrags,
+		Shots:                s.Shots - o.Shots,
+		Xp:                   s.Xp - o.Xp,
+		SurvivedBattles:      s.SurvivedBattles - o.SurvivedBattles,
+		DroppedCapturePoints: s.DroppedCapturePoints - o.DroppedCapturePoints,
 	}
 }
 
+// API endpoints
+const (
+	wgAPIVehicles    = "/wotb/tanks/stats/"
+	wgAPIBaseStats   = "/wotb/account/info/"
+	wgAPIClanInfo    = "/wotb/clans/list/"
+	wgAPIClanDetails = "/wotb/clans/info/"
+)
+
 // GetVehicleStats - Get current vehicle stats for a player by playerID
-func GetVehicleStats(playerID int, realm string) ([]VehicleStats, error) {
-	domain, err := getAPIDomain(realm)
-	if err != nil {
-		log.Println(err)
-		var result []VehicleStats
-		return result, err
-	}
+func (c *Client) GetVehicleStats(ctx context.Context, realm Realm, playerID int) ([]VehicleStats, error) {
 	// Get current stats
 	playerIDStr := strconv.Itoa(playerID)
-	finalURL := domain + wgAPIVehicles + playerIDStr
+	query := url.Values{"account_id": {playerIDStr}}
 	response := new(playerVehiclesRes)
 
-	err = utils.GetJSON(finalURL, response)
+	err := c.getJSON(ctx, realm, wgAPIVehicles, query, response)
 	if err != nil {
-		// Check error and retry if timed out or reached limit
-		panic(err)
+		return nil, err
 	}
-	return response.Data[playerIDStr], nil
-
+	vehicles, ok := response.Data[playerIDStr]
+	if !ok {
+		return nil, fmt.Errorf("player %d on %s: %w", playerID, realm, ErrAccountNotFound)
+	}
+	if vehicles == nil {
+		// The account exists but has not played any vehicle yet
+		return []VehicleStats{}, nil
+	}
+	return vehicles, nil
 }
 
 // GetClanIDbyTag - Find clanID by tag and realm
-func GetClanIDbyTag(realm string, clanTag string) (int, error) {
-	realm = strings.ToUpper(realm)
+func (c *Client) GetClanIDbyTag(ctx context.Context, realm Realm, clanTag string) (int, error) {
 	clanTag = strings.ToUpper(clanTag)
 
-	domain, err := getAPIDomain(realm)
-	if err != nil {
-		return 0, err
-	}
 	// Search for clan by tag
-	fullURL := domain + wgAPIClanInfo + clanTag
+	query := url.Values{"search": {clanTag}}
 	var response = new(clanInfoRes)
-	err = utils.GetJSON(fullURL, response)
+	err := c.getJSON(ctx, realm, wgAPIClanInfo, query, response)
 	if err != nil {
 		return 0, err
 	}
@@ -168,16 +175,14 @@ func GetClanIDbyTag(realm string, clanTag string) (int, error) {
 }
 
 // GetClanDataByID - Get clan detailed data from clanID and realm
-func GetClanDataByID(realm string, clanID int) (ClanDetails, error) {
-	realm = strings.ToUpper(realm)
-	domain, err := getAPIDomain(realm)
-	if err != nil {
-		var result ClanDetails
-		return result, err
+func (c *Client) GetClanDataByID(ctx context.Context, realm Realm, clanID int) (ClanDetails, error) {
+	query := url.Values{
+		"fields":  {"clan_id,name,tag,is_clan_disbanded,members_ids,updated_at,members"},
+		"extra":   {"members"},
+		"clan_id": {strconv.Itoa(clanID)},
 	}
-	fullURL := domain + wgAPIClanDetails + strconv.Itoa(clanID)
 	var response = new(clanMembersRes)
-	err = utils.GetJSON(fullURL, response)
+	err := c.getJSON(ctx, realm, wgAPIClanDetails, query, response)
 	if err != nil {
 		var result ClanDetails
 		return result, err
@@ -191,25 +196,55 @@ func GetClanDataByID(realm string, clanID int) (ClanDetails, error) {
 	return result, nil
 }
 
+// maxAccountIDs - Most account IDs WG accepts in a single account info request
+const maxAccountIDs = 100
+
+// GetPlayersDataByIDs - Get account data for many players, batched into requests of up to 100 IDs
+// Accounts that do not exist are left out of the result
+func (c *Client) GetPlayersDataByIDs(ctx context.Context, realm Realm, pids []int) (map[int]AccountInfo, error) {
+	result := make(map[int]AccountInfo, len(pids))
+	for start := 0; start < len(pids); start += maxAccountIDs {
+		end := start + maxAccountIDs
+		if end > len(pids) {
+			end = len(pids)
+		}
+
+		ids := make([]string, 0, end-start)
+		for _, pid := range pids[start:end] {
+			ids = append(ids, strconv.Itoa(pid))
+		}
+		query := url.Values{
+			"fields":     {"account_id,nickname,last_battle_time,statistics.all.battles"},
+			"account_id": {strings.Join(ids, ",")},
+		}
+		var response = new(accountInfoRes)
+		err := c.getJSON(ctx, realm, wgAPIBaseStats, query, response)
+		if err != nil {
+			return result, err
+		}
+		for _, data := range response.Data {
+			if data != nil {
+				result[data.ID] = *data
+			}
+		}
+	}
+	return result, nil
+}
+
 // GetPlayerDataByID - Get player data from player ID
-func GetPlayerDataByID(realm string, pid int) (PlayerRes, error) {
-	realm = strings.ToUpper(realm)
-	domain, err := getAPIDomain(realm)
+func (c *Client) GetPlayerDataByID(ctx context.Context, realm Realm, pid int) (PlayerRes, error) {
+	accounts, err := c.GetPlayersDataByIDs(ctx, realm, []int{pid})
 	if err != nil {
 		var result PlayerRes
 		return result, err
 	}
-	fullURL := domain + wgAPIBaseStats + strconv.Itoa(pid)
-	var response = new(PlayerResRaw)
-	err = utils.GetJSON(fullURL, response)
-	if err != nil {
-		var result PlayerRes
-		return result, err
+	data, ok := accounts[pid]
+	if !ok {
+		return PlayerRes{}, fmt.Errorf("player %d on %s: %w", pid, realm, ErrAccountNotFound)
 	}
-
 	var playerData PlayerRes
-	playerData.ID = response.Data[(strconv.Itoa(pid))].ID
-	playerData.Nickname = response.Data[(strconv.Itoa(pid))].Nickname
+	playerData.ID = data.ID
+	playerData.Nickname = data.Nickname
 
 	return playerData, nil
 }
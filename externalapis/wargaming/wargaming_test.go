@@ -0,0 +1,98 @@
+package externalapis
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGetPlayersDataByIDsBatches(t *testing.T) {
+	var mu sync.Mutex
+	var batches []int
+	client := newTestClient(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		ids := strings.Split(r.URL.Query().Get("account_id"), ",")
+		mu.Lock()
+		batches = append(batches, len(ids))
+		mu.Unlock()
+
+		// Every third account does not exist
+		data := make(map[string]*AccountInfo, len(ids))
+		for _, id := range ids {
+			pid, _ := strconv.Atoi(id)
+			if pid%3 == 0 {
+				data[id] = nil
+				continue
+			}
+			data[id] = &AccountInfo{ID: pid, Nickname: "player" + id}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "data": data})
+	})
+
+	pids := make([]int, 250)
+	for i := range pids {
+		pids[i] = i + 1
+	}
+	accounts, err := client.GetPlayersDataByIDs(context.Background(), RealmNA, pids)
+	if err != nil {
+		t.Fatalf("GetPlayersDataByIDs() error = %v", err)
+	}
+	if !equalBatches(batches, []int{100, 100, 50}) {
+		t.Errorf("GetPlayersDataByIDs() sent batches of %v, want [100 100 50]", batches)
+	}
+	if len(accounts) != 167 {
+		t.Errorf("GetPlayersDataByIDs() returned %d accounts, want 167 without the missing ones", len(accounts))
+	}
+	if account, ok := accounts[250]; !ok || account.Nickname != "player250" {
+		t.Errorf("GetPlayersDataByIDs() account 250 = %+v, want it from the last batch", account)
+	}
+	if _, ok := accounts[3]; ok {
+		t.Error("GetPlayersDataByIDs() returned a missing account")
+	}
+}
+
+func TestGetPlayersDataByIDsEmpty(t *testing.T) {
+	client := newTestClient(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("GetPlayersDataByIDs() without IDs sent a request")
+	})
+	accounts, err := client.GetPlayersDataByIDs(context.Background(), RealmNA, nil)
+	if err != nil || len(accounts) != 0 {
+		t.Errorf("GetPlayersDataByIDs() without IDs = %v, %v", accounts, err)
+	}
+}
+
+func TestGetPlayersDataByIDsError(t *testing.T) {
+	var requests int
+	client := newTestClient(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"status":"ok","data":{"1":{"account_id":1}}}`))
+	})
+	pids := make([]int, 300)
+	for i := range pids {
+		pids[i] = i + 1
+	}
+	// A failed batch stops the lookup and keeps what was found before it
+	accounts, err := client.GetPlayersDataByIDs(context.Background(), RealmNA, pids)
+	if err == nil || requests != 2 || len(accounts) != 1 {
+		t.Errorf("GetPlayersDataByIDs() with a failing batch = %d accounts, %v after %d requests", len(accounts), err, requests)
+	}
+}
+
+func equalBatches(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -5,5 +5,6 @@ go 1.15
 require (
 	github.com/gorilla/handlers v1.5.0
 	github.com/gorilla/mux v1.8.0
+	go.etcd.io/bbolt v1.3.5
 	go.mongodb.org/mongo-driver v1.4.1
 )
@@ -1,10 +1,145 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	// Clan time zones should not depend on zoneinfo being installed on the host
+	_ "time/tzdata"
+
+	"github.com/cufee/am-clanactivity/config"
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	mongo "github.com/cufee/am-clanactivity/mongoapi"
+	proc "github.com/cufee/am-clanactivity/processing"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+	"github.com/cufee/am-clanactivity/store/bolt"
+	"github.com/cufee/am-clanactivity/store/memory"
 	webapi "github.com/cufee/am-clanactivity/webapi"
 )
 
 func main() {
+	configPath := flag.String("config", "config.json", "path to JSON config file")
+	flag.Parse()
+
+	// Load config
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Loaded config:", cfg)
+	rating.RegisterBuiltin()
+
+	// Set up packages
+	wg, err := wgapi.NewClientFromConfig(cfg.Wargaming)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := openStore(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	processor := proc.New(db, wg, cfg.Processing)
+
+	// Load tank averages
+	if err := processor.TankCache().Refresh(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Loaded", processor.TankCache().Stats().Tanks, "tank averages")
+	background, stopBackground := context.WithCancel(context.Background())
+	tanksDone := make(chan struct{})
+	go func() {
+		defer close(tanksDone)
+		processor.TankCache().Run(background, cfg.Processing.TankAveragesRefresh.Std())
+	}()
+	rollupsDone := make(chan struct{})
+	go func() {
+		defer close(rollupsDone)
+		processor.RunRollups(background, cfg.Processing.RollupInterval.Std())
+	}()
+
+	// Refresh enrolled clans in the background
+	scheduler := proc.NewScheduler(processor, cfg.Scheduler.Interval.Std())
+	if cfg.Scheduler.Enabled {
+		scheduler.Start(context.Background())
+	}
+
+	// Enrollment, reset and refresh requests run as background jobs
+	jobs := proc.NewJobQueue(processor, cfg.Processing.JobWorkers)
+	if err := jobs.Start(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
 	// Run app
-	webapi.HandleRequests(10000)
+	api := webapi.New(db, processor, wg, scheduler, jobs)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- api.HandleRequests(cfg.Server)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	exitCode := 0
+	select {
+	case sig := <-signals:
+		log.Println("Received", sig, "shutting down")
+	case err := <-serveErr:
+		log.Println("Webserver failed:", err)
+		exitCode = 1
+	}
+
+	// Requests, the clan being refreshed and running jobs share one deadline, so a deploy is never blocked for long
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Std())
+	defer cancel()
+	if err := api.Shutdown(ctx); err != nil {
+		log.Println("Webserver did not finish in-flight requests:", err)
+	}
+	scheduler.Shutdown(ctx)
+	jobs.Stop(ctx)
+	// Background loops may be writing when cancelled, the store is closed once they returned
+	stopBackground()
+	for _, done := range []chan struct{}{tanksDone, rollupsDone} {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			log.Println("Background work did not stop in time")
+		}
+	}
+	if err := db.Close(ctx); err != nil {
+		log.Println(err)
+	}
+	log.Println("Shutdown complete")
+	os.Exit(exitCode)
+}
+
+// openStore - Create the storage backend selected in config
+func openStore(cfg config.Config) (store.Store, error) {
+	switch cfg.Storage.Backend {
+	case config.BackendMemory:
+		db := memory.New()
+		if cfg.Storage.TankAveragesFile != "" {
+			file, err := os.Open(cfg.Storage.TankAveragesFile)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+			count, err := db.LoadTankAverages(file)
+			if err != nil {
+				return nil, err
+			}
+			log.Println("Loaded", count, "tank averages into memory store")
+		}
+		return db, nil
+	case config.BackendMongo:
+		return mongo.New(cfg.Mongo)
+	case config.BackendBolt:
+		return bolt.New(cfg.Storage.BoltPath)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %s", cfg.Storage.Backend)
+	}
 }
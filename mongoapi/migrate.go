@@ -0,0 +1,215 @@
+package mongoapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// MigrateRealmKeys - Rewrite documents keyed by WG ID alone to realm and ID keys, returning the number of documents migrated per collection
+// Clans without a realm get defaultRealm, other documents take the realm of their clan or player and fall back to defaultRealm
+// Migrated documents are left alone so the migration can be run again
+func (s *Store) MigrateRealmKeys(ctx context.Context, defaultRealm string) (map[string]int, error) {
+	defaultRealm = strings.ToUpper(defaultRealm)
+	migrated := make(map[string]int)
+
+	count, err := migrateCollection(ctx, s.clansCollection, "clan_id", func(doc bson.M) string {
+		if realm, ok := doc["realm"].(string); ok && realm != "" {
+			return realm
+		}
+		return defaultRealm
+	})
+	migrated["clans"] = count
+	if err != nil {
+		return migrated, fmt.Errorf("mongoapi/MigrateRealmKeys: clans: %w", err)
+	}
+
+	// Players are in the realm of their clan
+	clanRealms := make(map[int]string)
+	clans, err := s.ListClans(ctx)
+	if err != nil {
+		return migrated, fmt.Errorf("mongoapi/MigrateRealmKeys: %w", err)
+	}
+	for _, clan := range clans {
+		clanRealms[clan.ID] = clan.Realm
+	}
+	clanRealm := func(doc bson.M) string {
+		if clanID, ok := numericID(doc["clan_id"]); ok && clanRealms[clanID] != "" {
+			return clanRealms[clanID]
+		}
+		return defaultRealm
+	}
+	count, err = migrateCollection(ctx, s.playersCollection, "player_id", clanRealm)
+	migrated["players"] = count
+	if err != nil {
+		return migrated, fmt.Errorf("mongoapi/MigrateRealmKeys: players: %w", err)
+	}
+
+	playerRealms := make(map[int]string)
+	var players []store.Player
+	if err := findAll(ctx, s.playersCollection, bson.M{}, &players); err != nil {
+		return migrated, fmt.Errorf("mongoapi/MigrateRealmKeys: %w", err)
+	}
+	for _, player := range players {
+		playerRealms[player.ID] = player.Realm
+	}
+	count, err = migrateCollection(ctx, s.snapshotsCollection, "player_id", func(doc bson.M) string {
+		if playerID, ok := numericID(doc["_id"]); ok && playerRealms[playerID] != "" {
+			return playerRealms[playerID]
+		}
+		return defaultRealm
+	})
+	migrated["vehicle_snapshots"] = count
+	if err != nil {
+		return migrated, fmt.Errorf("mongoapi/MigrateRealmKeys: vehicle_snapshots: %w", err)
+	}
+	count, err = migrateCollection(ctx, s.schedulesCollection, "clan_id", func(doc bson.M) string {
+		if clanID, ok := numericID(doc["_id"]); ok && clanRealms[clanID] != "" {
+			return clanRealms[clanID]
+		}
+		return defaultRealm
+	})
+	migrated["schedules"] = count
+	if err != nil {
+		return migrated, fmt.Errorf("mongoapi/MigrateRealmKeys: schedules: %w", err)
+	}
+
+	// Unique indexes from before realms would reject the same clan ID in two realms
+	legacyIndexes := map[*mongo.Collection]string{
+		s.activityCollection:  "clan_id_1_date_1_player_id_1",
+		s.sessionsCollection:  "clan_id_1_session_id_1",
+		s.baselinesCollection: "clan_id_1_window_1_player_id_1",
+	}
+	for collection, name := range legacyIndexes {
+		if _, err := collection.Indexes().DropOne(ctx, name); err != nil && !isIndexNotFound(err) {
+			return migrated, fmt.Errorf("mongoapi/MigrateRealmKeys: %s: %w", collection.Name(), err)
+		}
+	}
+
+	// Remaining documents keep their keys and only need the realm of their clan, snapshots of clanless players use the player realm
+	byRealm := func(realms map[int]string) map[string][]int {
+		ids := make(map[string][]int)
+		for id, realm := range realms {
+			ids[realm] = append(ids[realm], id)
+		}
+		return ids
+	}
+	clanIDs, playerIDs := byRealm(clanRealms), byRealm(playerRealms)
+	for _, collection := range []*mongo.Collection{s.historyCollection, s.activityCollection, s.eventsCollection, s.sessionsCollection, s.windowsCollection, s.baselinesCollection} {
+		count, err := setMissingRealm(ctx, collection, "clan_id", clanIDs)
+		if err == nil && collection == s.historyCollection {
+			var players int
+			players, err = setMissingRealm(ctx, collection, "player_id", playerIDs)
+			count += players
+		}
+		if err == nil {
+			var rest int
+			rest, err = setMissingRealm(ctx, collection, "", map[string][]int{defaultRealm: nil})
+			count += rest
+		}
+		migrated[collection.Name()] = count
+		if err != nil {
+			return migrated, fmt.Errorf("mongoapi/MigrateRealmKeys: %s: %w", collection.Name(), err)
+		}
+	}
+	return migrated, nil
+}
+
+// setMissingRealm - Set the realm on documents that do not have one and whose idField is one of the IDs listed for it
+// An empty idField sets the realm on every document without one
+func setMissingRealm(ctx context.Context, collection *mongo.Collection, idField string, ids map[string][]int) (int, error) {
+	var total int
+	for realm, realmIDs := range ids {
+		filter := bson.M{"realm": bson.M{"$in": bson.A{nil, ""}}}
+		if idField != "" {
+			filter[idField] = bson.M{"$in": realmIDs}
+		}
+		result, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"realm": realm}})
+		if err != nil {
+			return total, err
+		}
+		total += int(result.ModifiedCount)
+	}
+	return total, nil
+}
+
+// isIndexNotFound - Dropping an index that does not exist, or from a collection that does not exist, is not an error for the migration
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Code == 27 || cmdErr.Code == 26)
+}
+
+// CountLegacyKeys - Count documents still keyed by WG ID alone or without a realm, they need MigrateRealmKeys before they can be read
+func (s *Store) CountLegacyKeys(ctx context.Context) (int, error) {
+	var total int64
+	for _, collection := range []*mongo.Collection{s.clansCollection, s.playersCollection, s.snapshotsCollection, s.schedulesCollection} {
+		count, err := collection.CountDocuments(ctx, legacyKeyFilter)
+		if err != nil {
+			return 0, fmt.Errorf("mongoapi/CountLegacyKeys: %w", err)
+		}
+		total += count
+	}
+	for _, collection := range []*mongo.Collection{s.historyCollection, s.activityCollection, s.eventsCollection, s.sessionsCollection, s.windowsCollection, s.baselinesCollection} {
+		count, err := collection.CountDocuments(ctx, bson.M{"realm": bson.M{"$in": bson.A{nil, ""}}})
+		if err != nil {
+			return 0, fmt.Errorf("mongoapi/CountLegacyKeys: %w", err)
+		}
+		total += count
+	}
+	return int(total), nil
+}
+
+// legacyKeyFilter - Documents keyed by a numeric WG ID instead of realm and ID
+var legacyKeyFilter = bson.M{"_id": bson.M{"$type": "number"}}
+
+// migrateCollection - Move every document with a numeric _id to a realm and ID key, keeping the ID in idField
+func migrateCollection(ctx context.Context, collection *mongo.Collection, idField string, realmOf func(doc bson.M) string) (int, error) {
+	cur, err := collection.Find(ctx, legacyKeyFilter)
+	if err != nil {
+		return 0, err
+	}
+	var docs []bson.M
+	if err := cur.All(ctx, &docs); err != nil {
+		return 0, err
+	}
+
+	for i, doc := range docs {
+		oldID := doc["_id"]
+		id, _ := numericID(oldID)
+		realm := strings.ToUpper(realmOf(doc))
+
+		doc["_id"] = store.RecordKey(realm, id)
+		doc[idField] = id
+		doc["realm"] = realm
+		// Write the new document before removing the old one, so an interrupted run loses nothing
+		_, err := collection.ReplaceOne(ctx, bson.M{"_id": doc["_id"]}, doc, options.Replace().SetUpsert(true))
+		if err != nil {
+			return i, err
+		}
+		if _, err := collection.DeleteOne(ctx, bson.M{"_id": oldID}); err != nil {
+			return i, err
+		}
+	}
+	return len(docs), nil
+}
+
+// numericID - Read a WG ID stored as any BSON number
+func numericID(value interface{}) (int, bool) {
+	switch id := value.(type) {
+	case int32:
+		return int(id), true
+	case int64:
+		return int(id), true
+	case float64:
+		return int(id), true
+	default:
+		return 0, false
+	}
+}
@@ -13,163 +13,624 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 
 	"github.com/cufee/am-clanactivity/config"
+	"github.com/cufee/am-clanactivity/store"
 )
 
-// BSON
-
-// TankAverages - Struct for getting tank averages data from DB
-type TankAverages struct {
-	All struct {
-		Battles              float64 `bson:"battles,omitempty"`
-		DroppedCapturePoints float64 `bson:"dropped_capture_points,omitempty"`
-	} `bson:"all"`
-	Special struct {
-		Winrate         float64 `bson:"winrate,omitempty"`
-		DamageRatio     float64 `bson:"damageRatio,omitempty"`
-		Kdr             float64 `bson:"kdr,omitempty"`
-		DamagePerBattle float64 `bson:"damagePerBattle,omitempty"`
-		KillsPerBattle  float64 `bson:"killsPerBattle,omitempty"`
-		HitsPerBattle   float64 `bson:"hitsPerBattle,omitempty"`
-		SpotsPerBattle  float64 `bson:"spotsPerBattle,omitempty"`
-		Wpm             float64 `bson:"wpm,omitempty"`
-		Dpm             float64 `bson:"dpm,omitempty"`
-		Kpm             float64 `bson:"kpm,omitempty"`
-		HitRate         float64 `bson:"hitRate,omitempty"`
-		SurvivalRate    float64 `bson:"survivalRate,omitempty"`
-	} `bson:"special"`
-	Name   string `bson:"name"`
-	Tier   int    `bson:"tier"`
-	Nation string `bson:"nation"`
-}
-
-// Clan DB record struct
-type Clan struct {
-	ID         int       `bson:"_id" json:"clan_id"`
-	ClanName   string    `bson:"clan_name" json:"clan_name"`
-	ClanTag    string    `bson:"clan_tag" json:"clan_tag"`
-	MembersIds []int     `bson:"members_ids" json:"members_ids"`
-	Realm      string    `bson:"realm" json:"realm"`
-	LastUpdate time.Time `bson:"last_update" json:"last_update"`
-}
-
-// Player DB record struct
-type Player struct {
-	ID                int       `bson:"_id" json:"player_id"`
-	JoinedAt          int       `bson:"joined_at" json:"joined_at"`
-	Nickname          string    `bson:"nickname" json:"nickname"`
-	PremiumExpiration int       `bson:"premium_expiration" json:"premium_expiration"`
-	AverageRating     int       `bson:"average_rating" json:"average_rating"`
-	Battles           int       `bson:"battles" json:"battles"`
-	SessionBattles    int       `json:"session_battles"`
-	SessionRating     int       `json:"session_rating"`
-	LastUpdate        time.Time `bson:"last_update" json:"last_update"`
-}
-
-// Collections
-var clansCollection *mongo.Collection
-var playersCollection *mongo.Collection
-var tankAveragesCollection *mongo.Collection
-var ctx = context.TODO()
-
-func init() {
+// Store - MongoDB implementation of store.Store
+type Store struct {
+	client                 *mongo.Client
+	clansCollection        *mongo.Collection
+	playersCollection      *mongo.Collection
+	tankAveragesCollection *mongo.Collection
+	snapshotsCollection    *mongo.Collection
+	historyCollection      *mongo.Collection
+	activityCollection     *mongo.Collection
+	eventsCollection       *mongo.Collection
+	schedulesCollection    *mongo.Collection
+	sessionsCollection     *mongo.Collection
+	windowsCollection      *mongo.Collection
+	baselinesCollection    *mongo.Collection
+	jobsCollection         *mongo.Collection
+}
+
+var _ store.Store = (*Store)(nil)
+
+// New - Connect to MongoDB and set up collections
+func New(cfg config.MongoConfig) (*Store, error) {
 	// Conenct to MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout.Std())
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.URI))
 	if err != nil {
-		log.Println("Panic in mongoapi/init")
-		panic(err)
+		return nil, fmt.Errorf("mongoapi/New: %v", err)
 	}
 	// Ping the primary
 	if err := client.Ping(ctx, readpref.Primary()); err != nil {
-		log.Println("Panic in mongoapi/init")
-		panic(err)
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("mongoapi/New: %v", err)
 	}
 	log.Println("Successfully connected and pinged.")
 
 	// Collections
-	clansCollection = client.Database("clan_activity").Collection("clans")
-	playersCollection = client.Database("clan_activity").Collection("players")
-	tankAveragesCollection = client.Database("glossary").Collection("tankaverages")
+	s := &Store{
+		client:                 client,
+		clansCollection:        client.Database(cfg.Database).Collection("clans"),
+		playersCollection:      client.Database(cfg.Database).Collection("players"),
+		tankAveragesCollection: client.Database(cfg.GlossaryDatabase).Collection("tankaverages"),
+		snapshotsCollection:    client.Database(cfg.Database).Collection("vehicle_snapshots"),
+		historyCollection:      client.Database(cfg.Database).Collection("snapshots"),
+		activityCollection:     client.Database(cfg.Database).Collection("daily_activity"),
+		eventsCollection:       client.Database(cfg.Database).Collection("member_events"),
+		schedulesCollection:    client.Database(cfg.Database).Collection("schedules"),
+		sessionsCollection:     client.Database(cfg.Database).Collection("sessions"),
+		windowsCollection:      client.Database(cfg.Database).Collection("windows"),
+		baselinesCollection:    client.Database(cfg.Database).Collection("window_snapshots"),
+		jobsCollection:         client.Database(cfg.Database).Collection("jobs"),
+	}
+
+	// Clans and players are keyed by realm and ID, lookups by ID or tag alone still need an index
+	_, err = s.clansCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "clan_id", Value: 1}, {Key: "realm", Value: 1}}},
+		{Keys: bson.D{{Key: "clan_tag", Value: 1}, {Key: "realm", Value: 1}}},
+	})
+	if err != nil {
+		log.Println("mongoapi/New: failed to create clan indexes:", err)
+	}
+	_, err = s.playersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "player_id", Value: 1}, {Key: "realm", Value: 1}},
+	})
+	if err != nil {
+		log.Println("mongoapi/New: failed to create player index:", err)
+	}
+	// Snapshots are always queried by player or clan over a time range
+	// Clan and player scoped indexes include the realm, WG IDs are only unique within one
+	_, err = s.historyCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "player_id", Value: 1}, {Key: "realm", Value: 1}, {Key: "timestamp", Value: 1}}},
+		{Keys: bson.D{{Key: "clan_id", Value: 1}, {Key: "realm", Value: 1}, {Key: "timestamp", Value: 1}}},
+	})
+	if err != nil {
+		log.Println("mongoapi/New: failed to create snapshot indexes:", err)
+	}
+	_, err = s.activityCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "clan_id", Value: 1}, {Key: "realm", Value: 1}, {Key: "date", Value: 1}, {Key: "player_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Println("mongoapi/New: failed to create daily activity index:", err)
+	}
+	_, err = s.eventsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "clan_id", Value: 1}, {Key: "realm", Value: 1}, {Key: "timestamp", Value: 1}},
+	})
+	if err != nil {
+		log.Println("mongoapi/New: failed to create member events index:", err)
+	}
+	_, err = s.sessionsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "clan_id", Value: 1}, {Key: "realm", Value: 1}, {Key: "session_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Println("mongoapi/New: failed to create sessions index:", err)
+	}
+	_, err = s.baselinesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "clan_id", Value: 1}, {Key: "realm", Value: 1}, {Key: "window", Value: 1}, {Key: "player_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Println("mongoapi/New: failed to create window snapshots index:", err)
+	}
+	return s, nil
 }
 
-// CLANS
+// Close - Disconnect from MongoDB
+func (s *Store) Close(ctx context.Context) error {
+	return s.client.Disconnect(ctx)
+}
+
+// findOne - FindOne wrapper that maps ErrNoDocuments to store.ErrNotFound
+func findOne(ctx context.Context, collection *mongo.Collection, filter bson.M, target interface{}) error {
+	err := collection.FindOne(ctx, filter).Decode(target)
+	if err == mongo.ErrNoDocuments {
+		return store.ErrNotFound
+	}
+	return err
+}
 
-// GetClan - Retrieve clan record from db using bson.M filter
-func GetClan(filter interface{}) (Clan, error) {
-	var clanData Clan
-	err := clansCollection.FindOne(ctx, filter).Decode(&clanData)
+// updateOne - UpdateOne wrapper with optional upsert
+func updateOne(ctx context.Context, collection *mongo.Collection, id interface{}, update interface{}, upsert bool) error {
+	opts := options.Update().SetUpsert(upsert)
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update}, opts)
 	if err != nil {
-		return clanData, err
+		return err
+	}
+	if !upsert && result.MatchedCount == 0 {
+		return store.ErrNotFound
 	}
-	return clanData, nil
+	return nil
 }
 
-// UpdateClan - Update a clan record in a db, with optional upsert
-func UpdateClan(clanData Clan, upsert bool) (string, error) {
-	// set upsert
-	var opts *options.UpdateOptions
-	if upsert {
-		opts = options.Update().SetUpsert(true)
-	} else {
-		opts = options.Update().SetUpsert(false)
+// findAll - Find wrapper that decodes all documents matching filter into target slice
+func findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, target interface{}) error {
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return cur.All(ctx, target)
+}
+
+// CLANS
+
+// ListClans - Retrieve all clan records
+func (s *Store) ListClans(ctx context.Context) ([]store.Clan, error) {
+	var clans []store.Clan
+	err := findAll(ctx, s.clansCollection, bson.M{}, &clans)
+	return clans, err
+}
+
+// GetClan - Retrieve clan record from db
+func (s *Store) GetClan(ctx context.Context, filter store.ClanFilter) (store.Clan, error) {
+	if filter.Empty() {
+		return store.Clan{}, fmt.Errorf("mongoapi/GetClan: %w", store.ErrEmptyFilter)
+	}
+	filter = filter.Normalize()
+	query := bson.M{}
+	if filter.ID != 0 {
+		query["clan_id"] = filter.ID
 	}
+	if filter.Tag != "" {
+		query["clan_tag"] = filter.Tag
+	}
+	if filter.Realm != "" {
+		query["realm"] = filter.Realm
+	}
+
+	var clanData store.Clan
+	err := findOne(ctx, s.clansCollection, query, &clanData)
+	return clanData, err
+}
+
+// UpdateClan - Update a clan record in a db, with optional upsert
+func (s *Store) UpdateClan(ctx context.Context, clanData store.Clan, upsert bool) error {
 	// Set LastUpdate
-	loc, _ := time.LoadLocation("UTC")
-	clanData.LastUpdate = time.Now().In(loc)
-	// Update and return result/error
-	filter := bson.M{"_id": clanData.ID}
-	result, err := clansCollection.UpdateOne(ctx, filter, bson.M{"$set": clanData}, opts)
+	clanData.LastUpdate = time.Now().UTC()
+	clanData = store.NormalizeClan(clanData)
+	// Update and return error, documents are keyed by realm and ID and upserts take the key from the filter
+	err := updateOne(ctx, s.clansCollection, store.RecordKey(clanData.Realm, clanData.ID), clanData, upsert)
 	if err != nil {
-		return "mongoapi/UpdateClan: Error updating clan record.", err
+		return fmt.Errorf("mongoapi/UpdateClan: %w", err)
 	}
-	resultStr := fmt.Sprintf("%+v", result)
-	return resultStr, nil
+	return nil
 }
 
 // PLAYERS
 
-// GetPlayer - Retrieve player record from db using bson.M filter
-func GetPlayer(filter interface{}) (Player, error) {
-	var playerData Player
-	err := playersCollection.FindOne(ctx, filter).Decode(&playerData)
-	if err != nil {
-		return playerData, err
+// ListPlayers - Retrieve all player records
+func (s *Store) ListPlayers(ctx context.Context) ([]store.Player, error) {
+	var players []store.Player
+	err := findAll(ctx, s.playersCollection, bson.M{}, &players)
+	return players, err
+}
+
+// GetPlayer - Retrieve player record from db
+func (s *Store) GetPlayer(ctx context.Context, filter store.PlayerFilter) (store.Player, error) {
+	if filter.Empty() {
+		return store.Player{}, fmt.Errorf("mongoapi/GetPlayer: %w", store.ErrEmptyFilter)
+	}
+	filter = filter.Normalize()
+	query := bson.M{}
+	if filter.ID != 0 {
+		query["player_id"] = filter.ID
+	}
+	if filter.Realm != "" {
+		query["realm"] = filter.Realm
 	}
-	return playerData, nil
+
+	var playerData store.Player
+	err := findOne(ctx, s.playersCollection, query, &playerData)
+	return playerData, err
 }
 
 // UpdatePlayer - Update a player record in a db, with optional upsert
-func UpdatePlayer(playerData Player, upsert bool) (string, error) {
-	// set upsert
-	var opts *options.UpdateOptions
-	if upsert {
-		opts = options.Update().SetUpsert(true)
-	} else {
-		opts = options.Update().SetUpsert(false)
-	}
+func (s *Store) UpdatePlayer(ctx context.Context, playerData store.Player, upsert bool) error {
 	// Set LastUpdate
-	loc, _ := time.LoadLocation("UTC")
-	playerData.LastUpdate = time.Now().In(loc)
-	// Update and return result/error
-	filter := bson.M{"_id": playerData.ID}
-	result, err := playersCollection.UpdateOne(ctx, filter, bson.M{"$set": playerData}, opts)
+	playerData.LastUpdate = time.Now().UTC()
+	playerData = store.NormalizePlayer(playerData)
+	// Update and return error, documents are keyed by realm and ID and upserts take the key from the filter
+	err := updateOne(ctx, s.playersCollection, store.RecordKey(playerData.Realm, playerData.ID), playerData, upsert)
 	if err != nil {
-		return "mongoapi/UpdatePlayer: Error updating player record.", err
+		return fmt.Errorf("mongoapi/UpdatePlayer: %w", err)
 	}
-	resultStr := fmt.Sprintf("%+v", result)
-	return resultStr, nil
+	return nil
 }
 
-// TANKAVERAGES
+// VEHICLE SNAPSHOTS
+
+// GetVehicleSnapshot - Get the vehicle stats saved for a player at session start
+func (s *Store) GetVehicleSnapshot(ctx context.Context, realm string, playerID int) (store.VehicleSnapshot, error) {
+	var snapshot store.VehicleSnapshot
+	err := findOne(ctx, s.snapshotsCollection, bson.M{"_id": store.RecordKey(realm, playerID)}, &snapshot)
+	return snapshot, err
+}
+
+// UpdateVehicleSnapshot - Save vehicle stats for a player, replacing any existing snapshot
+func (s *Store) UpdateVehicleSnapshot(ctx context.Context, snapshot store.VehicleSnapshot) error {
+	opts := options.Replace().SetUpsert(true)
+	_, err := s.snapshotsCollection.ReplaceOne(ctx, bson.M{"_id": store.RecordKey(snapshot.Realm, snapshot.PlayerID)}, snapshot, opts)
+	if err != nil {
+		return fmt.Errorf("mongoapi/UpdateVehicleSnapshot: %w", err)
+	}
+	return nil
+}
 
-// GetTankAvg - Get averages data for a tank using a bson.M filter
-func GetTankAvg(filter interface{}) (TankAverages, error) {
-	var tankData TankAverages
-	err := tankAveragesCollection.FindOne(ctx, filter).Decode(&tankData)
+// TRACKING WINDOWS
+
+// ListTrackingWindows - Retrieve all tracking windows of a clan ordered by name
+func (s *Store) ListTrackingWindows(ctx context.Context, realm string, clanID int) ([]store.TrackingWindow, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cur, err := s.windowsCollection.Find(ctx, bson.M{"clan_id": clanID, "realm": realm}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var windows []store.TrackingWindow
+	err = cur.All(ctx, &windows)
+	return windows, err
+}
+
+// GetTrackingWindow - Retrieve a tracking window of a clan by name
+func (s *Store) GetTrackingWindow(ctx context.Context, realm string, clanID int, name string) (store.TrackingWindow, error) {
+	var window store.TrackingWindow
+	err := findOne(ctx, s.windowsCollection, bson.M{"clan_id": clanID, "realm": realm, "name": name}, &window)
+	return window, err
+}
+
+// UpdateTrackingWindow - Save a tracking window, replacing any existing one with the same name
+func (s *Store) UpdateTrackingWindow(ctx context.Context, window store.TrackingWindow) error {
+	opts := options.Replace().SetUpsert(true)
+	_, err := s.windowsCollection.ReplaceOne(ctx, bson.M{"clan_id": window.ClanID, "realm": window.Realm, "name": window.Name}, window, opts)
+	if err != nil {
+		return fmt.Errorf("mongoapi/UpdateTrackingWindow: %w", err)
+	}
+	return nil
+}
+
+// DeleteTrackingWindow - Remove a tracking window and all of its baselines
+func (s *Store) DeleteTrackingWindow(ctx context.Context, realm string, clanID int, name string) error {
+	result, err := s.windowsCollection.DeleteOne(ctx, bson.M{"clan_id": clanID, "realm": realm, "name": name})
+	if err != nil {
+		return fmt.Errorf("mongoapi/DeleteTrackingWindow: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return store.ErrNotFound
+	}
+	_, err = s.baselinesCollection.DeleteMany(ctx, bson.M{"clan_id": clanID, "realm": realm, "window": name})
 	if err != nil {
-		return tankData, err
+		return fmt.Errorf("mongoapi/DeleteTrackingWindow: %w", err)
 	}
-	return tankData, nil
+	return nil
+}
+
+// GetWindowSnapshot - Get the vehicle stats saved for a player when a tracking window started
+func (s *Store) GetWindowSnapshot(ctx context.Context, realm string, clanID int, window string, playerID int) (store.WindowSnapshot, error) {
+	var snapshot store.WindowSnapshot
+	err := findOne(ctx, s.baselinesCollection, bson.M{"clan_id": clanID, "realm": realm, "window": window, "player_id": playerID}, &snapshot)
+	return snapshot, err
+}
+
+// UpdateWindowSnapshot - Save a tracking window baseline for a player, replacing any existing one
+func (s *Store) UpdateWindowSnapshot(ctx context.Context, snapshot store.WindowSnapshot) error {
+	opts := options.Replace().SetUpsert(true)
+	filter := bson.M{"clan_id": snapshot.ClanID, "realm": snapshot.Realm, "window": snapshot.Window, "player_id": snapshot.PlayerID}
+	_, err := s.baselinesCollection.ReplaceOne(ctx, filter, snapshot, opts)
+	if err != nil {
+		return fmt.Errorf("mongoapi/UpdateWindowSnapshot: %w", err)
+	}
+	return nil
+}
+
+// SNAPSHOTS
+
+// AddSnapshot - Record player totals at a point in time
+func (s *Store) AddSnapshot(ctx context.Context, snapshot store.Snapshot) error {
+	_, err := s.historyCollection.InsertOne(ctx, snapshot)
+	if err != nil {
+		return fmt.Errorf("mongoapi/AddSnapshot: %w", err)
+	}
+	return nil
+}
+
+// snapshotQuery - Build a snapshot query from filter
+func snapshotQuery(filter store.SnapshotFilter) bson.M {
+	filter = filter.Normalize()
+	query := bson.M{}
+	if filter.Realm != "" {
+		query["realm"] = filter.Realm
+	}
+	if filter.PlayerID != 0 {
+		query["player_id"] = filter.PlayerID
+	}
+	if len(filter.PlayerIDs) > 0 {
+		query["player_id"] = bson.M{"$in": filter.PlayerIDs}
+	}
+	if filter.ClanID != 0 {
+		query["clan_id"] = filter.ClanID
+	}
+	timestamp := bson.M{}
+	if !filter.From.IsZero() {
+		timestamp["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timestamp["$lt"] = filter.To
+	}
+	if len(timestamp) > 0 {
+		query["timestamp"] = timestamp
+	}
+	return query
+}
+
+// GetSnapshots - Get snapshots matching filter, oldest first
+func (s *Store) GetSnapshots(ctx context.Context, filter store.SnapshotFilter) ([]store.Snapshot, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+	cur, err := s.historyCollection.Find(ctx, snapshotQuery(filter), opts)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []store.Snapshot
+	err = cur.All(ctx, &snapshots)
+	return snapshots, err
+}
+
+// GetLatestSnapshots - Get the most recent snapshot of each player matching filter, ordered by player ID
+func (s *Store) GetLatestSnapshots(ctx context.Context, filter store.SnapshotFilter) ([]store.Snapshot, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: snapshotQuery(filter)}},
+		{{Key: "$sort", Value: bson.D{{Key: "player_id", Value: 1}, {Key: "timestamp", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$player_id"}, {Key: "snapshot", Value: bson.M{"$first": "$$ROOT"}}}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$snapshot"}}},
+		{{Key: "$sort", Value: bson.D{{Key: "player_id", Value: 1}}}},
+	}
+	cur, err := s.historyCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []store.Snapshot
+	err = cur.All(ctx, &snapshots)
+	return snapshots, err
+}
+
+// DAILY ACTIVITY
+
+// UpdateDailyActivity - Save daily rollups, replacing existing rows for the same realm, clan, player and date
+func (s *Store) UpdateDailyActivity(ctx context.Context, days []store.DailyActivity) error {
+	if len(days) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(days))
+	for _, day := range days {
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"clan_id": day.ClanID, "realm": day.Realm, "player_id": day.PlayerID, "date": day.Date}).
+			SetReplacement(day).
+			SetUpsert(true))
+	}
+	_, err := s.activityCollection.BulkWrite(ctx, models)
+	if err != nil {
+		return fmt.Errorf("mongoapi/UpdateDailyActivity: %w", err)
+	}
+	return nil
+}
+
+// GetDailyActivity - Get daily rollups matching filter, ordered by date
+func (s *Store) GetDailyActivity(ctx context.Context, filter store.DailyActivityFilter) ([]store.DailyActivity, error) {
+	filter = filter.Normalize()
+	query := bson.M{}
+	if filter.Realm != "" {
+		query["realm"] = filter.Realm
+	}
+	if filter.ClanID != 0 {
+		query["clan_id"] = filter.ClanID
+	}
+	if filter.PlayerID != 0 {
+		query["player_id"] = filter.PlayerID
+	}
+	date := bson.M{}
+	if filter.From != "" {
+		date["$gte"] = filter.From
+	}
+	if filter.To != "" {
+		date["$lte"] = filter.To
+	}
+	if len(date) > 0 {
+		query["date"] = date
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "player_id", Value: 1}})
+	cur, err := s.activityCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var days []store.DailyActivity
+	err = cur.All(ctx, &days)
+	return days, err
+}
+
+// MEMBER EVENTS
+
+// AddMemberEvents - Record clan roster changes
+func (s *Store) AddMemberEvents(ctx context.Context, events []store.MemberEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	documents := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		documents = append(documents, event)
+	}
+	_, err := s.eventsCollection.InsertMany(ctx, documents)
+	if err != nil {
+		return fmt.Errorf("mongoapi/AddMemberEvents: %w", err)
+	}
+	return nil
+}
+
+// GetMemberEvents - Get roster changes matching filter, oldest first
+func (s *Store) GetMemberEvents(ctx context.Context, filter store.MemberEventFilter) ([]store.MemberEvent, error) {
+	filter = filter.Normalize()
+	query := bson.M{}
+	if filter.Realm != "" {
+		query["realm"] = filter.Realm
+	}
+	if filter.ClanID != 0 {
+		query["clan_id"] = filter.ClanID
+	}
+	if filter.PlayerID != 0 {
+		query["player_id"] = filter.PlayerID
+	}
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+	timestamp := bson.M{}
+	if !filter.From.IsZero() {
+		timestamp["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timestamp["$lt"] = filter.To
+	}
+	if len(timestamp) > 0 {
+		query["timestamp"] = timestamp
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+	cur, err := s.eventsCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var events []store.MemberEvent
+	err = cur.All(ctx, &events)
+	return events, err
+}
+
+// SCHEDULES
+
+// ListClanSchedules - Retrieve background refresh state of all clans
+func (s *Store) ListClanSchedules(ctx context.Context) ([]store.ClanSchedule, error) {
+	var schedules []store.ClanSchedule
+	err := findAll(ctx, s.schedulesCollection, bson.M{}, &schedules)
+	return schedules, err
+}
+
+// UpdateClanSchedule - Save background refresh state for a clan, replacing any existing one
+func (s *Store) UpdateClanSchedule(ctx context.Context, schedule store.ClanSchedule) error {
+	opts := options.Replace().SetUpsert(true)
+	_, err := s.schedulesCollection.ReplaceOne(ctx, bson.M{"_id": store.RecordKey(schedule.Realm, schedule.ClanID)}, schedule, opts)
+	if err != nil {
+		return fmt.Errorf("mongoapi/UpdateClanSchedule: %w", err)
+	}
+	return nil
+}
+
+// CLAN SESSIONS
+
+// AddClanSession - Archive a closed clan session
+func (s *Store) AddClanSession(ctx context.Context, session store.ClanSession) error {
+	_, err := s.sessionsCollection.InsertOne(ctx, session)
+	if err != nil {
+		return fmt.Errorf("mongoapi/AddClanSession: %w", err)
+	}
+	return nil
+}
+
+// ListClanSessions - Get archived sessions matching filter, newest first
+func (s *Store) ListClanSessions(ctx context.Context, filter store.ClanSessionFilter) ([]store.ClanSession, error) {
+	filter = filter.Normalize()
+	query := bson.M{}
+	if filter.Realm != "" {
+		query["realm"] = filter.Realm
+	}
+	if filter.ClanID != 0 {
+		query["clan_id"] = filter.ClanID
+	}
+	endedAt := bson.M{}
+	if !filter.From.IsZero() {
+		endedAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		endedAt["$lt"] = filter.To
+	}
+	if len(endedAt) > 0 {
+		query["ended_at"] = endedAt
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "ended_at", Value: -1}})
+	cur, err := s.sessionsCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var sessions []store.ClanSession
+	err = cur.All(ctx, &sessions)
+	return sessions, err
+}
+
+// GetClanSession - Get an archived session of a clan by ID
+func (s *Store) GetClanSession(ctx context.Context, realm string, clanID int, sessionID int64) (store.ClanSession, error) {
+	var session store.ClanSession
+	err := findOne(ctx, s.sessionsCollection, bson.M{"clan_id": clanID, "realm": store.NormalizeRealm(realm), "session_id": sessionID}, &session)
+	return session, err
+}
+
+// JOBS
+
+// GetJob - Retrieve a background job by ID
+func (s *Store) GetJob(ctx context.Context, id string) (store.Job, error) {
+	var job store.Job
+	err := findOne(ctx, s.jobsCollection, bson.M{"_id": id}, &job)
+	return job, err
+}
+
+// ListJobs - Retrieve background jobs matching filter, oldest first
+func (s *Store) ListJobs(ctx context.Context, filter store.JobFilter) ([]store.Job, error) {
+	query := bson.M{}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cur, err := s.jobsCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []store.Job
+	err = cur.All(ctx, &jobs)
+	return jobs, err
+}
+
+// UpdateJob - Save a background job, replacing any existing one with the same ID
+func (s *Store) UpdateJob(ctx context.Context, job store.Job) error {
+	opts := options.Replace().SetUpsert(true)
+	_, err := s.jobsCollection.ReplaceOne(ctx, bson.M{"_id": job.ID}, job, opts)
+	if err != nil {
+		return fmt.Errorf("mongoapi/UpdateJob: %w", err)
+	}
+	return nil
+}
+
+// TANKAVERAGES
+
+// ListTankAverages - Get averages data for all tanks
+func (s *Store) ListTankAverages(ctx context.Context) ([]store.TankAverages, error) {
+	var tanks []store.TankAverages
+	err := findAll(ctx, s.tankAveragesCollection, bson.M{}, &tanks)
+	return tanks, err
+}
+
+// GetTankAvg - Get averages data for a tank
+func (s *Store) GetTankAvg(ctx context.Context, filter store.TankFilter) (store.TankAverages, error) {
+	if filter.Empty() {
+		return store.TankAverages{}, fmt.Errorf("mongoapi/GetTankAvg: %w", store.ErrEmptyFilter)
+	}
+	query := bson.M{}
+	if filter.TankID != 0 {
+		query["tank_id"] = filter.TankID
+	}
+
+	var tankData store.TankAverages
+	err := findOne(ctx, s.tankAveragesCollection, query, &tankData)
+	return tankData, err
 }
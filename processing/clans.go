@@ -1,74 +1,92 @@
 package processing
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"sync"
 
 	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
-	mongo "github.com/cufee/am-clanactivity/mongoapi"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
 )
 
 // EnableNewClan - Enable tracking for a new clan and all players in that clan
-func EnableNewClan(realm string, clanTag string) error {
-	clanID, err := wgapi.GetClanIDbyTag(realm, clanTag)
+func (p *Processor) EnableNewClan(ctx context.Context, realm wgapi.Realm, clanTag string) error {
+	clanID, err := p.wg.GetClanIDbyTag(ctx, realm, clanTag)
 	if err != nil {
 		return err
 	}
-	clanData, err := wgapi.GetClanDataByID(realm, clanID)
+	clanData, err := p.wg.GetClanDataByID(ctx, realm, clanID)
 	if err != nil {
 		return err
 	}
 
-	filter := bson.M{"_id": clanData.ID}
-	check, err := mongo.GetClan(filter)
-
-	if check.ID != 0 {
+	_, err = p.db.GetClan(ctx, store.ClanFilter{ID: clanData.ID, Realm: string(realm)})
+	if err == nil {
 		// Check if clan already in DB
 		return fmt.Errorf("clan %s is already enrolled", (clanData.ClanTag))
-	} else if err != nil {
+	} else if !errors.Is(err, store.ErrNotFound) {
 		return err
 	}
 
-	var newClanEntry mongo.Clan
+	var newClanEntry store.Clan
 	newClanEntry.ID = clanData.ID
 	newClanEntry.ClanTag = clanData.ClanTag
 	newClanEntry.ClanName = clanData.ClanName
-	newClanEntry.Realm = realm
+	newClanEntry.Realm = string(realm)
 	newClanEntry.MembersIds = clanData.MembersIds
 
 	// Add clan to DB
-	_, err = mongo.UpdateClan(newClanEntry, true)
+	err = p.db.UpdateClan(ctx, newClanEntry, true)
 	if err != nil {
 		return err
 	}
 
-	// Add all players
-	var wg sync.WaitGroup
-	for _, p := range clanData.Members {
-		wg.Add(1)
+	r, err := rating.Get(rating.Default)
+	if err != nil {
+		return err
+	}
 
-		go func(p wgapi.PlayerRes) {
-			defer wg.Done()
-			// Get player battles
-			battles, err := GetPlayerVehBattles(p.ID)
-			if err != nil {
-				log.Println(err)
-			}
-			var newPlayerData mongo.Player
-			newPlayerData.ID = p.ID
-			newPlayerData.Nickname = p.Nickname
-			newPlayerData.LastUpdate = p.LastUpdate
-			newPlayerData.JoinedAt = p.JoinedAt
-			newPlayerData.Battles = battles
-			// Add player to DB (update with upsert)
-			_, err = mongo.UpdatePlayer(newPlayerData, true)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}(p)
+	// Add all players
+	progress := progressFrom(ctx)
+	progress.AddPlayers(len(clanData.Members))
+	group := p.players.Group(ctx, progress.PlayerDone)
+	for _, member := range clanData.Members {
+		member := member
+		group.Go(member.ID, func(ctx context.Context) error {
+			return p.addMember(ctx, r, realm, clanData.ID, member)
+		})
+	}
+	for _, err := range group.Wait() {
+		log.Println(err)
 	}
-	wg.Wait()
 	return nil
 }
+
+// addMember - Create or reactivate the player record for a clan member and start their session
+func (p *Processor) addMember(ctx context.Context, r rating.Rating, realm wgapi.Realm, clanID int, member wgapi.PlayerRes) error {
+	playerData, err := p.db.GetPlayer(ctx, store.PlayerFilter{ID: member.ID, Realm: string(realm)})
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	playerData.ID = member.ID
+	playerData.Realm = string(realm)
+	playerData.ClanID = clanID
+	playerData.Nickname = member.Nickname
+	playerData.Role = member.Role
+	playerData.JoinedAt = member.JoinedAt
+	playerData.LeftAt = nil
+
+	// Get current vehicle stats as session baseline
+	vehicles, err := p.wg.GetVehicleStats(ctx, realm, member.ID)
+	if err != nil {
+		// Session will start on the first refresh instead
+		if err := p.db.UpdatePlayer(ctx, playerData, true); err != nil {
+			return err
+		}
+		return fmt.Errorf("player added without session baseline: %w", err)
+	}
+	// Add player to DB (update with upsert)
+	return p.startSession(ctx, r, &playerData, vehicles, 0)
+}
@@ -0,0 +1,31 @@
+package processing
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// recordSnapshot - Save current player totals to the snapshots time series
+func (p *Processor) recordSnapshot(ctx context.Context, playerData store.Player) {
+	snapshot := store.Snapshot{
+		PlayerID:   playerData.ID,
+		ClanID:     playerData.ClanID,
+		Realm:      playerData.Realm,
+		Timestamp:  time.Now().UTC(),
+		Battles:    playerData.Battles + playerData.SessionBattles,
+		Rating:     playerData.AverageRating,
+		RatingType: ratingType(playerData),
+	}
+	// Career stats are always current totals, session battles may be relative to a tracking window
+	if playerData.CareerStats != nil {
+		snapshot.Battles = playerData.CareerStats.Battles
+		snapshot.Wins = playerData.CareerStats.Wins
+		snapshot.Damage = playerData.CareerStats.DamageDealt
+	}
+	if err := p.db.AddSnapshot(ctx, snapshot); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,73 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// InactiveMember - Clan member who has not played for a while
+type InactiveMember struct {
+	PlayerID       int    `json:"player_id"`
+	Nickname       string `json:"nickname"`
+	Role           string `json:"role,omitempty"`
+	LastBattleTime int    `json:"last_battle_time"`
+	InactiveDays   int    `json:"inactive_days"`
+	JoinedAt       int    `json:"joined_at,omitempty"`
+	TenureDays     int    `json:"tenure_days,omitempty"`
+}
+
+// InactivityReport - Members of a clan without battles for more than Days days, longest inactive first
+type InactivityReport struct {
+	ClanID  int              `json:"clan_id"`
+	Days    int              `json:"days"`
+	Members []InactiveMember `json:"members"`
+	// Unknown - Members whose last battle is not known yet, they get one on their next refresh
+	Unknown []int `json:"unknown"`
+}
+
+// InactiveMembers - Current members of a clan whose last battle is more than days days before now
+func (p *Processor) InactiveMembers(ctx context.Context, clanData store.Clan, days int, now time.Time) (InactivityReport, error) {
+	report := InactivityReport{ClanID: clanData.ID, Days: days, Members: []InactiveMember{}, Unknown: []int{}}
+	cutoff := now.AddDate(0, 0, -days)
+
+	for _, pid := range clanData.MembersIds {
+		playerData, err := p.db.GetPlayer(ctx, store.PlayerFilter{ID: pid, Realm: clanData.Realm})
+		if errors.Is(err, store.ErrNotFound) || (err == nil && playerData.LastBattleTime == 0) {
+			report.Unknown = append(report.Unknown, pid)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		// A member who last played exactly days days ago is not inactive yet
+		lastBattle := time.Unix(int64(playerData.LastBattleTime), 0)
+		if !lastBattle.Before(cutoff) {
+			continue
+		}
+		member := InactiveMember{
+			PlayerID:       playerData.ID,
+			Nickname:       playerData.Nickname,
+			Role:           playerData.Role,
+			LastBattleTime: playerData.LastBattleTime,
+			InactiveDays:   int(now.Sub(lastBattle).Hours() / 24),
+			JoinedAt:       playerData.JoinedAt,
+		}
+		if playerData.JoinedAt > 0 {
+			member.TenureDays = int(now.Sub(time.Unix(int64(playerData.JoinedAt), 0)).Hours() / 24)
+		}
+		report.Members = append(report.Members, member)
+	}
+
+	sort.Slice(report.Members, func(i, j int) bool {
+		if report.Members[i].LastBattleTime != report.Members[j].LastBattleTime {
+			return report.Members[i].LastBattleTime < report.Members[j].LastBattleTime
+		}
+		return report.Members[i].PlayerID < report.Members[j].PlayerID
+	})
+	return report, nil
+}
@@ -0,0 +1,116 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cufee/am-clanactivity/config"
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+	"github.com/cufee/am-clanactivity/store/memory"
+)
+
+func TestInactiveMembersWithoutNewBattles(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	lastBattle := int(now.AddDate(0, 0, -40).Unix())
+
+	// The account has not played since its baseline, so vehicle stats are never requested
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wotb/account/info/" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"ok","data":{"1001":{"account_id":1001,"nickname":"idle","last_battle_time":%d,"statistics":{"all":{"battles":500}}}}}`, lastBattle)
+	}))
+	defer server.Close()
+
+	r, err := rating.Get(rating.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := memory.New()
+	clanData := store.Clan{ID: 10, Realm: "NA", ClanTag: "IDLE", MembersIds: []int{1001}}
+	if err := db.UpdateClan(ctx, clanData, true); err != nil {
+		t.Fatal(err)
+	}
+	// A record from before last battle times were tracked
+	playerData := store.Player{ID: 1001, Realm: "NA", ClanID: 10, Nickname: "idle", Battles: 480, AccountBattles: 500, RatingBattles: 480, RatingType: r.Name()}
+	if err := db.UpdatePlayer(ctx, playerData, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateVehicleSnapshot(ctx, store.VehicleSnapshot{PlayerID: 1001, Realm: "NA"}); err != nil {
+		t.Fatal(err)
+	}
+
+	wg := wgapi.NewClient("test", server.Client(), map[wgapi.Realm]string{wgapi.RealmNA: server.URL})
+	p := New(db, wg, config.ProcessingConfig{MaxConcurrentPlayers: 1, MaxConcurrentVehicles: 1})
+
+	players := make(chan store.Player, 1)
+	p.PlayersFefreshSession(ctx, clanData.MembersIds, wgapi.RealmNA, RefreshOptions{Rating: r, ClanID: clanData.ID}, players)
+	for range players {
+	}
+
+	report, err := p.InactiveMembers(ctx, clanData, 30, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unknown) != 0 {
+		t.Errorf("Unknown = %v, want none", report.Unknown)
+	}
+	if len(report.Members) != 1 {
+		t.Fatalf("Members = %+v, want player 1001", report.Members)
+	}
+	if member := report.Members[0]; member.PlayerID != 1001 || member.LastBattleTime != lastBattle || member.InactiveDays != 40 {
+		t.Errorf("member = %+v, want player 1001 inactive for 40 days since %d", member, lastBattle)
+	}
+}
+
+func TestInactiveMembersCutoff(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	p := New(db, nil, config.ProcessingConfig{MaxConcurrentPlayers: 1, MaxConcurrentVehicles: 1})
+
+	now := time.Date(2021, 3, 31, 12, 0, 0, 0, time.UTC)
+	cutoff := now.AddDate(0, 0, -30)
+	lastBattles := map[int]time.Time{
+		1: cutoff.Add(-time.Second),
+		2: cutoff,
+		3: cutoff.Add(time.Second),
+		4: cutoff.AddDate(0, 0, -10),
+	}
+	clanData := store.Clan{ID: 10, Realm: "NA", ClanTag: "CUT", MembersIds: []int{1, 2, 3, 4, 5, 6}}
+	for pid, lastBattle := range lastBattles {
+		if err := db.UpdatePlayer(ctx, store.Player{ID: pid, Realm: "NA", ClanID: 10, LastBattleTime: int(lastBattle.Unix())}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Player 5 has no last battle yet and player 6 was never refreshed
+	if err := db.UpdatePlayer(ctx, store.Player{ID: 5, Realm: "NA", ClanID: 10}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := p.InactiveMembers(ctx, clanData, 30, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []int
+	for _, member := range report.Members {
+		listed = append(listed, member.PlayerID)
+	}
+	if fmt.Sprint(listed) != "[4 1]" {
+		t.Errorf("Members = %v, want [4 1], longest inactive first and without the member at exactly 30 days", listed)
+	}
+	if len(report.Members) == 2 && (report.Members[0].InactiveDays != 40 || report.Members[1].InactiveDays != 30) {
+		t.Errorf("InactiveDays = %d and %d, want 40 and 30", report.Members[0].InactiveDays, report.Members[1].InactiveDays)
+	}
+	if fmt.Sprint(report.Unknown) != "[5 6]" {
+		t.Errorf("Unknown = %v, want [5 6]", report.Unknown)
+	}
+}
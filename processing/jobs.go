@@ -0,0 +1,283 @@
+package processing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// ErrQueueFull - Returned when too many jobs are already waiting to run
+var ErrQueueFull = errors.New("job queue is full")
+
+// jobQueueSize - Jobs that can wait for a worker
+const jobQueueSize = 100
+
+// maxJobErrors - Per-player errors kept on a job, further failures are only counted
+const maxJobErrors = 100
+
+// RefreshResult - Result of a refresh job, the same data the clan export returns
+type RefreshResult struct {
+	Clan    store.Clan     `json:"clan_data"`
+	Window  string         `json:"window,omitempty"`
+	Players []store.Player `json:"players"`
+}
+
+// JobQueue - Runs clan enrollment, reset and refresh jobs in the background and persists their progress
+type JobQueue struct {
+	p       *Processor
+	workers int
+	queue   chan store.Job
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopping chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewJobQueue - Create a queue that runs up to workers jobs at a time
+func NewJobQueue(p *Processor, workers int) *JobQueue {
+	return &JobQueue{
+		p:        p,
+		workers:  workers,
+		queue:    make(chan store.Job, jobQueueSize),
+		stopping: make(chan struct{}),
+	}
+}
+
+// Start - Pick up jobs left over from a previous run and start the workers
+// Jobs that were running are failed since they stopped part way, queued jobs never started and run now
+func (q *JobQueue) Start(ctx context.Context) error {
+	running, err := q.p.db.ListJobs(ctx, store.JobFilter{Status: store.JobRunning})
+	if err != nil {
+		return err
+	}
+	for _, job := range running {
+		job.Status = store.JobFailed
+		job.Error = "interrupted by restart"
+		job.FinishedAt = time.Now().UTC()
+		if err := q.p.db.UpdateJob(ctx, job); err != nil {
+			log.Println(err)
+		}
+	}
+	queued, err := q.p.db.ListJobs(ctx, store.JobFilter{Status: store.JobQueued})
+	if err != nil {
+		return err
+	}
+	for _, job := range queued {
+		q.enqueue(ctx, job)
+	}
+
+	q.ctx, q.cancel = context.WithCancel(ctx)
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	log.Println("Started job queue with", q.workers, "workers,", len(queued), "jobs resumed")
+	return nil
+}
+
+// Stop - Stop taking jobs off the queue and let running jobs finish until ctx is done, then cancel them
+// Jobs still waiting stay queued in the store and run after the next start
+func (q *JobQueue) Stop(ctx context.Context) {
+	close(q.stopping)
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("Jobs did not finish in time, cancelling them")
+		q.cancel()
+		<-done
+	}
+	q.cancel()
+	log.Println("Stopped job queue")
+}
+
+// Submit - Queue a job, the returned job has its ID and status set
+func (q *JobQueue) Submit(ctx context.Context, job store.Job) (store.Job, error) {
+	job.ID = newJobID()
+	job.Status = store.JobQueued
+	job.CreatedAt = time.Now().UTC()
+	if err := q.p.db.UpdateJob(ctx, job); err != nil {
+		return job, err
+	}
+	return q.enqueue(ctx, job)
+}
+
+// enqueue - Hand a persisted job to the workers, failing it when the queue is full
+func (q *JobQueue) enqueue(ctx context.Context, job store.Job) (store.Job, error) {
+	select {
+	case q.queue <- job:
+		return job, nil
+	default:
+	}
+	job.Status = store.JobFailed
+	job.Error = ErrQueueFull.Error()
+	job.FinishedAt = time.Now().UTC()
+	if err := q.p.db.UpdateJob(ctx, job); err != nil {
+		log.Println(err)
+	}
+	return job, ErrQueueFull
+}
+
+// worker - Run queued jobs one at a time until the queue is stopped
+func (q *JobQueue) worker() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.stopping:
+			return
+		case job := <-q.queue:
+			select {
+			case <-q.stopping:
+				// Picked up while stopping, the job is still queued in the store
+				return
+			default:
+			}
+			q.run(job)
+		}
+	}
+}
+
+// run - Execute a job and persist its progress and outcome
+func (q *JobQueue) run(job store.Job) {
+	tracker := &jobTracker{db: q.p.db, job: job}
+	tracker.update(func(job *store.Job) {
+		job.Status = store.JobRunning
+		job.StartedAt = time.Now().UTC()
+	})
+
+	result, err := q.execute(WithProgress(q.ctx, tracker), job)
+	tracker.update(func(job *store.Job) {
+		job.FinishedAt = time.Now().UTC()
+		if q.ctx.Err() != nil {
+			// Players finished so far are saved, the rest of the job is lost
+			job.Status = store.JobFailed
+			job.Error = "interrupted by shutdown"
+			return
+		}
+		if err != nil {
+			job.Status = store.JobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = store.JobDone
+		data, err := json.Marshal(result)
+		if err != nil {
+			job.Error = "encoding result: " + err.Error()
+			return
+		}
+		job.Result = data
+	})
+}
+
+// execute - Run the operation a job describes
+func (q *JobQueue) execute(ctx context.Context, job store.Job) (interface{}, error) {
+	realm, err := wgapi.ParseRealm(job.Realm)
+	if err != nil {
+		return nil, err
+	}
+
+	switch job.Type {
+	case store.JobEnroll:
+		if err := q.p.EnableNewClan(ctx, realm, job.ClanTag); err != nil {
+			return nil, err
+		}
+		// Tags are stored the way WG returns them
+		return q.p.db.GetClan(ctx, store.ClanFilter{Tag: job.ClanTag, Realm: job.Realm})
+
+	case store.JobReset:
+		clanData, err := q.p.db.GetClan(ctx, store.ClanFilter{ID: job.ClanID, Realm: job.Realm})
+		if err != nil {
+			return nil, err
+		}
+		clanData.Realm = string(realm)
+		return q.p.ResetClanSession(ctx, clanData)
+
+	case store.JobRefresh:
+		clanData, err := q.p.db.GetClan(ctx, store.ClanFilter{ID: job.ClanID, Realm: job.Realm})
+		if err != nil {
+			return nil, err
+		}
+		r, err := rating.Get(job.Rating)
+		if err != nil {
+			return nil, err
+		}
+		opts := RefreshOptions{Rating: r, IncludeVehicles: job.IncludeVehicles, ClanID: clanData.ID, Window: job.Window}
+		players := make(chan store.Player, len(clanData.MembersIds))
+		q.p.PlayersFefreshSession(ctx, clanData.MembersIds, realm, opts, players)
+
+		result := RefreshResult{Clan: clanData, Window: job.Window, Players: []store.Player{}}
+		for playerData := range players {
+			result.Players = append(result.Players, playerData)
+		}
+		return result, ctx.Err()
+
+	default:
+		return nil, fmt.Errorf("unknown job type %s", job.Type)
+	}
+}
+
+// jobTracker - Progress that counts player outcomes on a job and saves every change
+type jobTracker struct {
+	db  store.Store
+	mu  sync.Mutex
+	job store.Job
+}
+
+// AddPlayers - More players are going to be processed
+func (t *jobTracker) AddPlayers(n int) {
+	t.update(func(job *store.Job) {
+		job.Players += n
+	})
+}
+
+// PlayerDone - A player was processed, err is nil on success
+func (t *jobTracker) PlayerDone(playerID int, err error) {
+	t.update(func(job *store.Job) {
+		job.PlayersDone++
+		if err == nil {
+			return
+		}
+		job.PlayersFailed++
+		if len(job.Errors) < maxJobErrors {
+			job.Errors = append(job.Errors, store.JobError{PlayerID: playerID, Error: err.Error()})
+		}
+	})
+}
+
+// update - Change the job and persist it
+// Saving is not tied to the job context, so the outcome of a cancelled job is still recorded
+func (t *jobTracker) update(fn func(job *store.Job)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fn(&t.job)
+	if err := t.db.UpdateJob(context.Background(), t.job); err != nil {
+		log.Println(err)
+	}
+}
+
+// newJobID - Random job ID
+func newJobID() string {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		// crypto/rand does not fail on supported platforms, fall back to the time just in case
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,162 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// newJobTestProcessor - Processor with one enrolled clan without members, so jobs on it need no WG requests
+func newJobTestProcessor(t *testing.T) (*Processor, store.Store) {
+	p, db := newTestProcessor(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+		http.NotFound(w, r)
+	})
+	if err := db.UpdateClan(context.Background(), store.Clan{ID: 10, Realm: "NA", ClanTag: "JOB"}, true); err != nil {
+		t.Fatal(err)
+	}
+	return p, db
+}
+
+// waitForJob - Wait until a stored job is finished
+func waitForJob(t *testing.T, db store.Store, id string) store.Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := db.GetJob(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == store.JobDone || job.Status == store.JobFailed {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is still %s", id, job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJobQueueRun(t *testing.T) {
+	ctx := context.Background()
+	p, db := newJobTestProcessor(t)
+	q := NewJobQueue(p, 2)
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop(ctx)
+
+	job, err := q.Submit(ctx, store.Job{Type: store.JobReset, Realm: "na", ClanID: 10})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if job.ID == "" || job.Status != store.JobQueued || job.CreatedAt.IsZero() {
+		t.Errorf("Submit() = %+v, want a queued job with an ID", job)
+	}
+
+	job = waitForJob(t, db, job.ID)
+	if job.Status != store.JobDone || job.Error != "" || job.StartedAt.IsZero() || job.FinishedAt.Before(job.StartedAt) {
+		t.Errorf("finished job = %+v, want done with start and finish times", job)
+	}
+	var session store.ClanSession
+	if err := json.Unmarshal(job.Result, &session); err != nil || session.ClanID != 10 {
+		t.Errorf("job result = %s, %v, want the archived session", job.Result, err)
+	}
+
+	job, err = q.Submit(ctx, store.Job{Type: "unknown", Realm: "NA", ClanID: 10})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if job = waitForJob(t, db, job.ID); job.Status != store.JobFailed || job.Error != "unknown job type unknown" {
+		t.Errorf("job of an unknown type = %+v, want failed", job)
+	}
+	job, err = q.Submit(ctx, store.Job{Type: store.JobRefresh, Realm: "NA", ClanID: 99})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if job = waitForJob(t, db, job.ID); job.Status != store.JobFailed || job.Error == "" {
+		t.Errorf("job for an unknown clan = %+v, want failed", job)
+	}
+}
+
+func TestJobQueueRestart(t *testing.T) {
+	ctx := context.Background()
+	p, db := newJobTestProcessor(t)
+
+	// A job that was running when the process died and one that never started
+	crashed := store.Job{ID: "crashed", Type: store.JobReset, Realm: "NA", ClanID: 10, Status: store.JobRunning, CreatedAt: time.Now().UTC()}
+	waiting := store.Job{ID: "waiting", Type: store.JobReset, Realm: "NA", ClanID: 10, Status: store.JobQueued, CreatedAt: time.Now().UTC()}
+	for _, job := range []store.Job{crashed, waiting} {
+		if err := db.UpdateJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := NewJobQueue(p, 1)
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop(ctx)
+
+	job, err := db.GetJob(ctx, "crashed")
+	if err != nil || job.Status != store.JobFailed || job.Error != "interrupted by restart" || job.FinishedAt.IsZero() {
+		t.Errorf("job running before the restart = %+v, %v, want failed", job, err)
+	}
+	if job := waitForJob(t, db, "waiting"); job.Status != store.JobDone {
+		t.Errorf("job queued before the restart = %+v, want it run after the start", job)
+	}
+}
+
+func TestJobQueueStopKeepsQueuedJobs(t *testing.T) {
+	ctx := context.Background()
+	p, db := newJobTestProcessor(t)
+
+	// Without workers nothing is taken off the queue before the stop
+	q := NewJobQueue(p, 0)
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.Submit(ctx, store.Job{Type: store.JobReset, Realm: "NA", ClanID: 10})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	q.Stop(ctx)
+	if stored, err := db.GetJob(ctx, job.ID); err != nil || stored.Status != store.JobQueued {
+		t.Fatalf("job after stop = %+v, %v, want it still queued", stored, err)
+	}
+
+	// The next queue on the same store picks it up
+	q = NewJobQueue(p, 1)
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop(ctx)
+	if stored := waitForJob(t, db, job.ID); stored.Status != store.JobDone {
+		t.Errorf("job after the next start = %+v, want done", stored)
+	}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	ctx := context.Background()
+	p, db := newJobTestProcessor(t)
+
+	// Not started, so every job waits in the queue
+	q := NewJobQueue(p, 1)
+	for i := 0; i < jobQueueSize; i++ {
+		if _, err := q.Submit(ctx, store.Job{Type: store.JobReset, Realm: "NA", ClanID: 10}); err != nil {
+			t.Fatalf("Submit() %d error = %v", i, err)
+		}
+	}
+	job, err := q.Submit(ctx, store.Job{Type: store.JobReset, Realm: "NA", ClanID: 10})
+	if !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit() on a full queue error = %v, want ErrQueueFull", err)
+	}
+	stored, err := db.GetJob(ctx, job.ID)
+	if err != nil || stored.Status != store.JobFailed || stored.Error != ErrQueueFull.Error() {
+		t.Errorf("job rejected by a full queue = %+v, %v, want it stored as failed", stored, err)
+	}
+}
@@ -1,231 +1,307 @@
 package processing
 
 import (
+	"context"
 	"errors"
 	"log"
-	"math"
-	"sync"
 	"sync/atomic"
-	"time"
 
 	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
-	mongo "github.com/cufee/am-clanactivity/mongoapi"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
 )
 
 // PlayersFefreshSession - Refresh sessions for a list of players
-func PlayersFefreshSession(players []int, realm string, channel chan mongo.Player) {
+func (p *Processor) PlayersFefreshSession(ctx context.Context, players []int, realm wgapi.Realm, opts RefreshOptions, channel chan store.Player) {
+	r := opts.Rating
 	// defer log.Println("Finished PlayersFefreshSession")
-	// Loop througp player IDs and start goroutines
-	var wg sync.WaitGroup
-	wg.Add(len(players))
-	for i, playerID := range players {
-		if (i % 15) == 0 {
-			time.Sleep(1 * time.Second)
+	defer close(channel)
+	progress := progressFrom(ctx)
+	progress.AddPlayers(len(players))
+
+	// Load tracked players, new players get a record with just an ID and start their session below
+	var tracked []store.Player
+	for _, pid := range players {
+		playerData, err := p.db.GetPlayer(ctx, store.PlayerFilter{ID: pid, Realm: string(realm)})
+		if errors.Is(err, store.ErrNotFound) {
+			playerData = store.Player{ID: pid, Realm: string(realm)}
+		} else if err != nil {
+			log.Println(err)
+			progress.PlayerDone(pid, err)
+			continue
 		}
-		go func(pid int) {
-			defer wg.Done()
-			filter := bson.M{"_id": pid}
-			playerData, err := mongo.GetPlayer(filter)
-			if err != nil {
-				// Get player data
-				playerRes, err := wgapi.GetPlayerDataByID(realm, pid)
-				if err != nil {
-					log.Println(err)
-					return
-				}
-				// Get player battles
-				battles, err := GetPlayerVehBattles(pid)
-				if err != nil {
-					log.Println(err)
-				}
-				// Add player to DB
-				var newPlayerData mongo.Player
-				newPlayerData.ID = pid
-				newPlayerData.Battles = battles
-				newPlayerData.Nickname = playerRes.Nickname
-				newPlayerData.PremiumExpiration = 0
-				newPlayerData.SessionBattles = 0
-				newPlayerData.SessionRating = 0
-				_, err = mongo.UpdatePlayer(newPlayerData, true)
-				if err != nil {
+		if opts.ClanID != 0 {
+			playerData.ClanID = opts.ClanID
+		}
+		tracked = append(tracked, playerData)
+	}
+
+	// Check current battle counts in one batched request, players who did not play since
+	// their session started and have an up to date rating do not need vehicle stats
+	trackedIDs := make([]int, 0, len(tracked))
+	for _, playerData := range tracked {
+		trackedIDs = append(trackedIDs, playerData.ID)
+	}
+	accounts, err := p.wg.GetPlayersDataByIDs(ctx, realm, trackedIDs)
+	if err != nil {
+		// Fall back to a full refresh for everyone
+		log.Println(err)
+	}
+	var changed []store.Player
+	for _, playerData := range tracked {
+		account, ok := accounts[playerData.ID]
+		if ok && playerData.Nickname == "" {
+			playerData.Nickname = account.Nickname
+		}
+		// Window sessions are relative to their own baseline, so only the clan session can be skipped.
+		// Account totals are compared with the account total saved with the baseline, Battles is a vehicle sum
+		if opts.Window == "" && ok && playerData.AccountBattles > 0 && account.Statistics.All.Battles == playerData.AccountBattles && playerData.RatingBattles == playerData.Battles && ratingType(playerData) == r.Name() {
+			playerData.SessionBattles = 0
+			playerData.SessionRating = 0
+			playerData.SessionStats = &store.PlayerStats{}
+			// Vehicle stats are not loaded, the account still knows when the player last played
+			if account.LastBattleTime > playerData.LastBattleTime {
+				playerData.LastBattleTime = account.LastBattleTime
+				if err := p.saveLastBattle(ctx, playerData); err != nil {
 					log.Println(err)
-					return
 				}
-				channel <- newPlayerData
-				return
 			}
-			calcPlayerRating(playerData, channel)
-		}(playerID)
+			p.recordSnapshot(ctx, playerData)
+			progress.PlayerDone(playerData.ID, nil)
+			channel <- playerData
+			continue
+		}
+		changed = append(changed, playerData)
+	}
+
+	// Refresh changed players on the player pool
+	group := p.players.Group(ctx, progress.PlayerDone)
+	for _, playerData := range changed {
+		playerData := playerData
+		group.Go(playerData.ID, func(ctx context.Context) error {
+			playerData, err := p.calcPlayerRating(ctx, realm, opts, playerData, accounts[playerData.ID].Statistics.All.Battles)
+			if err == nil {
+				p.recordSnapshot(ctx, playerData)
+			}
+			channel <- playerData
+			return err
+		})
+	}
+	for _, err := range group.Wait() {
+		log.Println(err)
 	}
-	wg.Wait()
-	close(channel)
-	return
 }
 
-// GetPlayerVehBattles - Get player battles total from adding all vehicle battles
-func GetPlayerVehBattles(pid int) (int, error) {
-	vehicles, err := wgapi.GetVehicleStats(pid, "NA")
+// PlayersResetSession - Reset sessions for a list of players to their current vehicle stats
+func (p *Processor) PlayersResetSession(ctx context.Context, players []int, realm wgapi.Realm) {
+	// Get current battles for all players at once, to skip players who did not play since the last baseline
+	accounts, err := p.wg.GetPlayersDataByIDs(ctx, realm, players)
 	if err != nil {
-		return 0, err
+		log.Println(err)
 	}
-	var battles uint64
 
-	for _, t := range vehicles {
-		atomic.AddUint64(&battles, uint64(t.All.Battles))
+	progress := progressFrom(ctx)
+	progress.AddPlayers(len(players))
+
+	group := p.players.Group(ctx, progress.PlayerDone)
+	for _, pid := range players {
+		pid := pid
+		group.Go(pid, func(ctx context.Context) error {
+			account, ok := accounts[pid]
+			return p.resetPlayer(ctx, realm, pid, account, ok)
+		})
+	}
+	for _, err := range group.Wait() {
+		log.Println(err)
 	}
-	return int(battles), nil
 }
 
-// calcPlayerRating - Caculate player rating and return updated playerData to the channel
-func calcPlayerRating(playerData mongo.Player, playersChannel chan mongo.Player) {
-	// defer log.Println("Finished calcPlayerRating for", playerData.ID)
-	defer func() {
-		playersChannel <- playerData
-	}()
+// resetPlayer - Start a new session for a player, account is the current account data when known
+func (p *Processor) resetPlayer(ctx context.Context, realm wgapi.Realm, pid int, account wgapi.AccountInfo, knownAccount bool) error {
+	// Get player data
+	playerData, err := p.db.GetPlayer(ctx, store.PlayerFilter{ID: pid, Realm: string(realm)})
+	if err != nil {
+		return err
+	}
+	r, err := rating.Get(ratingType(playerData))
+	if err != nil {
+		return err
+	}
 
-	oldBattles := playerData.Battles
+	if knownAccount && account.LastBattleTime > playerData.LastBattleTime {
+		playerData.LastBattleTime = account.LastBattleTime
+	}
 
-	// Get live vehicle stats
-	vehicles, err := wgapi.GetVehicleStats(playerData.ID, "NA")
-	// log.Println(len(vehicles))
-	if len(vehicles) == 0 {
-		log.Println(playerData.ID)
-		playerData.SessionRating = 0
-		playerData.SessionBattles = 0
-		return
+	// Baseline is still current, only clear session values
+	if knownAccount && playerData.AccountBattles > 0 && account.Statistics.All.Battles == playerData.AccountBattles {
+		if _, err := p.db.GetVehicleSnapshot(ctx, string(realm), pid); err == nil {
+			playerData.SessionBattles = 0
+			playerData.SessionRating = 0
+			return p.db.UpdatePlayer(ctx, playerData, true)
+		}
 	}
 
-	// log.Println("Fetched vehicle stats for", playerData.ID)
+	vehicles, err := p.wg.GetVehicleStats(ctx, realm, pid)
 	if err != nil {
-		log.Println(err)
-		playerData.SessionRating = 0
-		playerData.SessionBattles = 0
-		return
+		return err
 	}
+	// Update player record
+	var accountBattles int
+	if knownAccount {
+		accountBattles = account.Statistics.All.Battles
+	}
+	return p.startSession(ctx, r, &playerData, vehicles, accountBattles)
+}
 
-	// Calcualte Raw rating and get total battles
-	battles, rawRating, err := CalcVehicleRawRating(vehicles)
+// calcPlayerRating - Caculate player rating and return updated playerData
+// accountBattles is the current account battle total, 0 when it is not known
+// On error playerData is returned with zeroed session values
+func (p *Processor) calcPlayerRating(ctx context.Context, realm wgapi.Realm, opts RefreshOptions, playerData store.Player, accountBattles int) (store.Player, error) {
+	r := opts.Rating
+	// defer log.Println("Finished calcPlayerRating for", playerData.ID)
+
+	// Get live vehicle stats
+	vehicles, err := p.wg.GetVehicleStats(ctx, realm, playerData.ID)
+	if err == nil && len(vehicles) == 0 {
+		err = errors.New("no vehicle stats")
+	}
 	if err != nil {
-		log.Println(err)
-		playerData.AverageRating = 0
 		playerData.SessionRating = 0
 		playerData.SessionBattles = 0
+		return playerData, err
+	}
+	playedSince := false
+	if last := lastBattleTime(vehicles); last > playerData.LastBattleTime {
+		playerData.LastBattleTime = last
+		playedSince = true
 	}
 
-	// log.Println("Current battles:", battles, "Last battles:", oldBattles)
-
-	if oldBattles == 0 {
-		oldBattles = int(battles)
-		playerData.Battles = int(battles)
-		playerData.AverageRating = int(math.Round(float64(rawRating) / float64(battles)))
-		playerData.SessionRating = 0
-		// Update player record
-		_, err := mongo.UpdatePlayer(playerData, false)
+	// Get session baseline
+	var baseline []wgapi.VehicleStats
+	if opts.Window != "" {
+		baseline, err = p.windowBaseline(ctx, realm, opts, playerData.ID, vehicles)
 		if err != nil {
-			log.Println(err)
+			playerData.SessionRating = 0
+			playerData.SessionBattles = 0
+			return playerData, err
 		}
-	}
+	} else {
+		snapshot, err := p.db.GetVehicleSnapshot(ctx, string(realm), playerData.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			// New player or a record from before vehicle snapshots, session starts now
+			return playerData, p.startSession(ctx, r, &playerData, vehicles, accountBattles)
+		}
+		if err != nil {
+			playerData.SessionRating = 0
+			playerData.SessionBattles = 0
+			return playerData, err
+		}
+		baseline = snapshot.Vehicles
 
-	// log.Println(oldBattles, int(battles))
+		if totalBattles(vehicles) < totalBattles(baseline) {
+			log.Println("Current battles cnt is less than old battles cnt for", playerData.Nickname)
+			return playerData, p.startSession(ctx, r, &playerData, vehicles, accountBattles)
+		}
+	}
 
-	if int(battles) < oldBattles {
-		log.Println(int(battles), oldBattles)
-		log.Println("Current battles cnt is less than old battles cnt for", playerData.Nickname)
-		playerData.Battles = int(battles)
+	// Session values come from what was played on each vehicle since the baseline
+	deltas := vehicleDeltas(vehicles, baseline)
+	averageRating, err := p.averageRating(ctx, r, vehicles)
+	var sessionRating int
+	if err == nil {
+		sessionRating, err = p.averageRating(ctx, r, deltas)
+	}
+	if err != nil {
 		playerData.SessionRating = 0
 		playerData.SessionBattles = 0
-		if len(vehicles) > 0 {
-			// Update player record
-			_, err := mongo.UpdatePlayer(playerData, false)
-			if err != nil {
-				log.Println(err)
-			}
-			return
-		}
-		return
+		return playerData, err
+	}
+	playerData.AverageRating = averageRating
+	playerData.SessionBattles = totalBattles(deltas)
+	playerData.SessionRating = sessionRating
+	playerData.SessionStats = calcPlayerStats(deltas)
+	playerData.CareerStats = calcPlayerStats(vehicles)
+	if opts.IncludeVehicles {
+		playerData.SessionVehicles = p.calcSessionVehicles(r, deltas)
 	}
 
-	// oldBattles defined at the start of this func
-	playerData.SessionBattles = int(battles) - oldBattles
-	if playerData.SessionBattles == 0 {
-		playerData.AverageRating = int(math.Round(float64(rawRating) / float64(battles)))
-		playerData.SessionRating = 0
-		return
+	if opts.Restart && opts.Window == "" {
+		// The next session starts exactly where this one was calculated, so no battles fall between them
+		next := playerData
+		playerData.RatingType = r.Name()
+		return playerData, p.startSession(ctx, r, &next, vehicles, accountBattles)
 	}
 
-	oldRating := playerData.AverageRating
-	playerData.AverageRating = int(math.Round(float64(rawRating) / float64(battles)))
-	playerData.Battles = int(battles)
-	sessionRatingWeighted := (playerData.AverageRating * int(battles)) - (oldRating * oldBattles)
-	sessionRating := sessionRatingWeighted / (int(battles) - oldBattles)
-	playerData.SessionRating = sessionRating
+	staleAccount := accountBattles > 0 && playerData.AccountBattles != accountBattles
+	if opts.Window == "" && playerData.SessionBattles == 0 && (playerData.RatingBattles != playerData.Battles || ratingType(playerData) != r.Name() || staleAccount) {
+		// Save rating and account total at session start, so the next refresh can skip vehicle stats.
+		// Nothing was played since the baseline, so the current account total still matches it
+		playerData.RatingBattles = playerData.Battles
+		playerData.RatingType = r.Name()
+		if accountBattles > 0 {
+			playerData.AccountBattles = accountBattles
+		}
+		err := p.db.UpdatePlayer(ctx, playerData, false)
+		if err != nil {
+			log.Println(err)
+		}
+	} else if playedSince {
+		if err := p.saveLastBattle(ctx, playerData); err != nil {
+			log.Println(err)
+		}
+	}
+	playerData.RatingType = r.Name()
+	return playerData, nil
+}
 
-	return
+// saveLastBattle - Save a newer last battle time, session values on playerData are not written to the stored record
+func (p *Processor) saveLastBattle(ctx context.Context, playerData store.Player) error {
+	stored, err := p.db.GetPlayer(ctx, store.PlayerFilter{ID: playerData.ID, Realm: playerData.Realm})
+	if err != nil {
+		return err
+	}
+	stored.LastBattleTime = playerData.LastBattleTime
+	return p.db.UpdatePlayer(ctx, stored, false)
 }
 
 // CalcVehicleRawRating - Calculate rating for a slice of VehicleStats structs.
-func CalcVehicleRawRating(vehicles []wgapi.VehicleStats) (int, int, error) {
+// Returns battles on rated vehicles and the battle weighted rating sum
+func (p *Processor) CalcVehicleRawRating(ctx context.Context, r rating.Rating, vehicles []wgapi.VehicleStats) (int, int, error) {
 	if len(vehicles) == 0 {
 		return 0, 0, errors.New("VehicleStats slice empty")
 	}
 
-	var battles uint64
-	var rawRating uint64
+	var battles int64
+	var rawRating int64
 
-	var wg sync.WaitGroup
-	// Calculate rating for all vehicles in go routines
-	wg.Add(len(vehicles))
+	// Calculate rating for all vehicles on the vehicle pool
+	group := p.vehicles.Group(ctx, nil)
 	for _, tank := range vehicles {
-		go func(tank wgapi.VehicleStats, wg *sync.WaitGroup) {
-			defer wg.Done()
-			filter := bson.M{"tank_id": tank.TankID}
-			tankAvgData, err := mongo.GetTankAvg(filter)
-			if err != nil {
+		tank := tank
+		group.Go(tank.TankID, func(ctx context.Context) error {
+			tankAvgData, ok := p.tanks.Get(tank.TankID)
+			if !ok {
 				// No tank average data, no need to spam log/report
-				return
+				return nil
 			}
-			if tankAvgData.All.Battles == 0 || tank.All.Battles == 0 {
+			vehicleRating, ok := rateVehicle(r, tank, tankAvgData)
+			if !ok {
 				log.Println("Bad average data for", tank.TankID)
-				return
+				return nil
 			}
 
-			// Expected values for WN8
-			expDef := tankAvgData.All.DroppedCapturePoints / tankAvgData.All.Battles
-			expFrag := tankAvgData.Special.KillsPerBattle
-			expSpot := tankAvgData.Special.SpotsPerBattle
-			expDmg := tankAvgData.Special.DamagePerBattle
-			expWr := tankAvgData.Special.Winrate
-
-			// Actual performance
-			pDef := tank.All.DroppedCapturePoints / tank.All.Battles
-			pFrag := tank.All.Frags / tank.All.Battles
-			pSpot := tank.All.Spotted / tank.All.Battles
-			pDmg := tank.All.DamageDealt / tank.All.Battles
-			pWr := tank.All.Wins / tank.All.Battles * 100
-
-			// Calculate WN8 metrics
-			rDef := pDef / expDef
-			rFrag := pFrag / expFrag
-			rSpot := pSpot / expSpot
-			rDmg := pDmg / expDmg
-			rWr := pWr / expWr
-
-			adjustedWr := math.Max(0, ((rWr - 0.71) / (1 - 0.71)))
-			adjustedDmg := math.Max(0, ((rDmg - 0.22) / (1 - 0.22)))
-			adjustedDef := math.Max(0, (math.Min(adjustedDmg+0.1, (rDef-0.10)/(1-0.10))))
-			adjustedSpot := math.Max(0, (math.Min(adjustedDmg+0.1, (rSpot-0.38)/(1-0.38))))
-			adjustedFrag := math.Max(0, (math.Min(adjustedDmg+0.2, (rFrag-0.12)/(1-0.12))))
-
-			rating := math.Round(((980 * adjustedDmg) + (210 * adjustedDmg * adjustedFrag) + (155 * adjustedFrag * adjustedSpot) + (75 * adjustedDef * adjustedFrag) + (145 * math.Min(1.8, adjustedWr))))
-
-			ratingWeighted := rating * tank.All.Battles
-
-			atomic.AddUint64(&battles, uint64(tank.All.Battles))
-			atomic.AddUint64(&rawRating, uint64(ratingWeighted))
-		}(tank, &wg)
-	}
-	wg.Wait()
+			ratingWeighted := vehicleRating * tank.All.Battles
+
+			atomic.AddInt64(&battles, int64(tank.All.Battles))
+			atomic.AddInt64(&rawRating, int64(ratingWeighted))
+			return nil
+		})
+	}
+	// Panicked vehicles are left out of the rating, vehicles skipped once ctx is cancelled fail it
+	group.Wait()
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
 
 	return int(battles), int(rawRating), nil
 }
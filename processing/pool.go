@@ -0,0 +1,97 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// Pool - Limits how many tasks run at the same time, shared by every caller
+type Pool struct {
+	slots chan struct{}
+}
+
+// TaskError - Failure of a single task in a group
+type TaskError struct {
+	ID  int
+	Err error
+}
+
+func (e TaskError) Error() string {
+	return fmt.Sprintf("%d: %v", e.ID, e.Err)
+}
+
+// NewPool - Create a pool that runs up to size tasks at a time
+func NewPool(size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{slots: make(chan struct{}, size)}
+}
+
+// Group - Start a batch of tasks on the pool that are waited on together
+// onDone is called after every task, including tasks that panicked or never ran because ctx was cancelled
+func (p *Pool) Group(ctx context.Context, onDone func(id int, err error)) *Group {
+	return &Group{pool: p, ctx: ctx, onDone: onDone}
+}
+
+// Group - Tasks started together on a Pool
+type Group struct {
+	pool   *Pool
+	ctx    context.Context
+	onDone func(id int, err error)
+
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []TaskError
+}
+
+// Go - Run fn once a pool slot is free, blocking until then
+// Tasks are skipped once the group context is cancelled
+func (g *Group) Go(id int, fn func(ctx context.Context) error) {
+	select {
+	case g.pool.slots <- struct{}{}:
+	case <-g.ctx.Done():
+		g.done(id, g.ctx.Err())
+		return
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() { <-g.pool.slots }()
+
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Task %d panicked: %v\n%s", id, r, debug.Stack())
+				err = fmt.Errorf("panic: %v", r)
+			}
+			g.done(id, err)
+		}()
+		err = fn(g.ctx)
+	}()
+}
+
+// Wait - Wait for all started tasks and return the ones that failed
+func (g *Group) Wait() []TaskError {
+	g.wg.Wait()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.errs
+}
+
+// done - Record the outcome of a task
+func (g *Group) done(id int, err error) {
+	if err != nil {
+		g.mu.Lock()
+		g.errs = append(g.errs, TaskError{ID: id, Err: err})
+		g.mu.Unlock()
+	}
+	if g.onDone != nil {
+		g.onDone(id, err)
+	}
+}
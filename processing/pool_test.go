@@ -0,0 +1,119 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// doneIDs - Records the tasks a group reported as done
+type doneIDs struct {
+	mu   sync.Mutex
+	errs map[int]error
+}
+
+func (d *doneIDs) done(id int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.errs == nil {
+		d.errs = make(map[int]error)
+	}
+	d.errs[id] = err
+}
+
+func TestPoolLimitsConcurrency(t *testing.T) {
+	pool := NewPool(2)
+	var mu sync.Mutex
+	running, peak := 0, 0
+
+	group := pool.Group(context.Background(), nil)
+	for i := 1; i <= 6; i++ {
+		group.Go(i, func(ctx context.Context) error {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		})
+	}
+	if errs := group.Wait(); len(errs) != 0 {
+		t.Errorf("Wait() = %v, want no errors", errs)
+	}
+	if peak != 2 {
+		t.Errorf("%d tasks ran at the same time, want 2", peak)
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	pool := NewPool(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := &doneIDs{}
+	group := pool.Group(ctx, done.done)
+
+	// The first task holds the only slot until the group is cancelled
+	started := make(chan struct{})
+	group.Go(1, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+	cancel()
+
+	ran := false
+	group.Go(2, func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	errs := group.Wait()
+	if ran {
+		t.Error("task started after the group was cancelled")
+	}
+	if len(errs) != 2 {
+		t.Fatalf("Wait() = %v, want both tasks cancelled", errs)
+	}
+	for _, id := range []int{1, 2} {
+		if err, ok := done.errs[id]; !ok || !errors.Is(err, context.Canceled) {
+			t.Errorf("onDone for task %d = %v, %v, want context.Canceled", id, err, ok)
+		}
+	}
+
+	// Slots of cancelled tasks are free for other groups
+	other := pool.Group(context.Background(), nil)
+	other.Go(3, func(ctx context.Context) error { return nil })
+	if errs := other.Wait(); len(errs) != 0 {
+		t.Errorf("Wait() after cancel = %v, want no errors", errs)
+	}
+}
+
+func TestPoolPanic(t *testing.T) {
+	pool := NewPool(1)
+	done := &doneIDs{}
+	group := pool.Group(context.Background(), done.done)
+
+	group.Go(1, func(ctx context.Context) error {
+		panic("boom")
+	})
+	// The panicking task releases its slot, so the next one still runs
+	group.Go(2, func(ctx context.Context) error {
+		return nil
+	})
+	errs := group.Wait()
+	if len(errs) != 1 || errs[0].ID != 1 || errs[0].Err.Error() != "panic: boom" {
+		t.Errorf("Wait() = %v, want task 1 failing with panic: boom", errs)
+	}
+	if err, ok := done.errs[1]; !ok || err == nil {
+		t.Errorf("onDone for the panicking task = %v, %v, want an error", err, ok)
+	}
+	if err, ok := done.errs[2]; !ok || err != nil {
+		t.Errorf("onDone for the task after the panic = %v, %v, want no error", err, ok)
+	}
+}
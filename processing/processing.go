@@ -0,0 +1,54 @@
+package processing
+
+import (
+	"sync"
+
+	"github.com/cufee/am-clanactivity/config"
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// Processor - Clan and player processing backed by a Store
+type Processor struct {
+	db       store.Store
+	wg       *wgapi.Client
+	tanks    *TankCache
+	players  *Pool
+	vehicles *Pool
+
+	resetMu    sync.Mutex
+	resetLocks map[string]*sync.Mutex
+}
+
+// RefreshOptions - What to calculate during a session refresh
+type RefreshOptions struct {
+	// Rating - Rating used for average and session ratings
+	Rating rating.Rating
+	// IncludeVehicles - Add a per-vehicle session breakdown to every player
+	IncludeVehicles bool
+	// ClanID - Clan the players belong to, recorded on player records and snapshots
+	ClanID int
+	// Window - Tracking window session values are relative to, empty for the clan session
+	Window string
+	// Restart - Start a new clan session from the vehicle stats the current one was calculated with
+	Restart bool
+}
+
+// New - Create a new Processor using db for storage and wg for Wargaming API calls
+func New(db store.Store, wg *wgapi.Client, cfg config.ProcessingConfig) *Processor {
+	return &Processor{
+		db:       db,
+		wg:       wg,
+		tanks:    NewTankCache(db),
+		players:  NewPool(cfg.MaxConcurrentPlayers),
+		vehicles: NewPool(cfg.MaxConcurrentVehicles),
+
+		resetLocks: make(map[string]*sync.Mutex),
+	}
+}
+
+// TankCache - Tank averages cache used for rating calculation
+func (p *Processor) TankCache() *TankCache {
+	return p.tanks
+}
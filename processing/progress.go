@@ -0,0 +1,31 @@
+package processing
+
+import "context"
+
+// Progress - Receives the outcome of every player processed by a long running operation
+type Progress interface {
+	// AddPlayers - More players are going to be processed
+	AddPlayers(n int)
+	// PlayerDone - A player was processed, err is nil on success
+	PlayerDone(playerID int, err error)
+}
+
+type progressKey struct{}
+
+// WithProgress - Report per-player outcomes of operations using ctx to progress
+func WithProgress(ctx context.Context, progress Progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+// progressFrom - Progress attached to ctx, or one that ignores everything
+func progressFrom(ctx context.Context) Progress {
+	if progress, ok := ctx.Value(progressKey{}).(Progress); ok && progress != nil {
+		return progress
+	}
+	return noProgress{}
+}
+
+type noProgress struct{}
+
+func (noProgress) AddPlayers(n int)                   {}
+func (noProgress) PlayerDone(playerID int, err error) {}
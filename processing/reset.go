@@ -0,0 +1,177 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// weekdays - Accepted weekday names for reset schedules
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// NextReset - First reset on schedule strictly after after, in loc
+func NextReset(schedule store.ResetSchedule, loc *time.Location, after time.Time) (time.Time, error) {
+	clock, err := time.Parse("15:04", schedule.Time)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid reset time %q, expected HH:MM", schedule.Time)
+	}
+	weekday, ok := weekdays[strings.ToLower(schedule.Weekday)]
+	if !ok && schedule.Weekday != "" {
+		return time.Time{}, fmt.Errorf("invalid reset weekday %q", schedule.Weekday)
+	}
+
+	local := after.In(loc)
+	for i := 0; i <= 7; i++ {
+		candidate := time.Date(local.Year(), local.Month(), local.Day()+i, clock.Hour(), clock.Minute(), 0, 0, loc)
+		if candidate.Hour() != clock.Hour() || candidate.Minute() != clock.Minute() {
+			// Skipped by a daylight saving change, reset as far past the gap as the time was into it, e.g. 02:30 becomes 03:30
+			_, offset := candidate.Add(-24 * time.Hour).Zone()
+			candidate = time.Date(local.Year(), local.Month(), local.Day()+i, clock.Hour(), clock.Minute(), 0, 0, time.FixedZone("", offset)).In(loc)
+		}
+		if !candidate.After(after) {
+			continue
+		}
+		if schedule.Weekday == "" || candidate.Weekday() == weekday {
+			return candidate, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no reset found for %v", schedule)
+}
+
+// ResetClanSession - Archive the current session of every clan member and start a new one
+// Resets of the same clan run one at a time
+func (p *Processor) ResetClanSession(ctx context.Context, clanData store.Clan) (store.ClanSession, error) {
+	lock := p.resetLock(clanData)
+	lock.Lock()
+	defer lock.Unlock()
+
+	session := store.ClanSession{ClanID: clanData.ID, Realm: clanData.Realm, Players: []store.SessionPlayer{}}
+
+	realm, err := wgapi.ParseRealm(clanData.Realm)
+	if err != nil {
+		return session, err
+	}
+	r, err := rating.Get(rating.Default)
+	if err != nil {
+		return session, err
+	}
+
+	// Baselines are replaced while the session is closed, so their start times are read first
+	startedAt := make(map[int]time.Time, len(clanData.MembersIds))
+	for _, pid := range clanData.MembersIds {
+		if snapshot, err := p.db.GetVehicleSnapshot(ctx, clanData.Realm, pid); err == nil {
+			startedAt[pid] = snapshot.CreatedAt
+		}
+	}
+
+	// Close the session with up to date numbers and start the next one from the same vehicle stats
+	failed := &failedPlayers{Progress: progressFrom(ctx)}
+	players := make(chan store.Player, len(clanData.MembersIds))
+	p.PlayersFefreshSession(WithProgress(ctx, failed), clanData.MembersIds, realm, RefreshOptions{Rating: r, ClanID: clanData.ID, Restart: true}, players)
+	for playerData := range players {
+		player := store.SessionPlayer{
+			PlayerID:   playerData.ID,
+			Nickname:   playerData.Nickname,
+			Battles:    playerData.SessionBattles,
+			Rating:     playerData.SessionRating,
+			RatingType: r.Name(),
+			StartedAt:  startedAt[playerData.ID],
+		}
+		session.Battles += player.Battles
+		if player.Battles > 0 {
+			session.ActivePlayers++
+		}
+		session.Players = append(session.Players, player)
+	}
+	if ctx.Err() != nil {
+		return session, ctx.Err()
+	}
+	session.EndedAt = time.Now().UTC()
+	session.ID = session.EndedAt.Unix()
+	sort.SliceStable(session.Players, func(i, j int) bool {
+		return session.Players[i].Battles > session.Players[j].Battles
+	})
+
+	// Session started where the previous archived one ended, or at the oldest player baseline
+	previous, err := p.db.ListClanSessions(ctx, store.ClanSessionFilter{ClanID: clanData.ID, Realm: clanData.Realm})
+	if err != nil {
+		return session, err
+	}
+	for _, prev := range previous {
+		// Two resets in the same second would otherwise share an ID
+		if prev.ID >= session.ID {
+			session.ID = prev.ID + 1
+		}
+	}
+	if len(previous) > 0 {
+		session.StartedAt = previous[0].EndedAt
+	} else {
+		for _, player := range session.Players {
+			if !player.StartedAt.IsZero() && (session.StartedAt.IsZero() || player.StartedAt.Before(session.StartedAt)) {
+				session.StartedAt = player.StartedAt
+			}
+		}
+	}
+
+	if err := p.db.AddClanSession(ctx, session); err != nil {
+		return session, err
+	}
+	// Players whose session could not be closed still get a new baseline, their progress was already reported
+	if ids := failed.IDs(); len(ids) > 0 {
+		p.PlayersResetSession(WithProgress(ctx, nil), ids, realm)
+	}
+	return session, nil
+}
+
+// resetLock - Lock held while a clan session is reset
+func (p *Processor) resetLock(clanData store.Clan) *sync.Mutex {
+	p.resetMu.Lock()
+	defer p.resetMu.Unlock()
+
+	key := store.RecordKey(clanData.Realm, clanData.ID)
+	lock, ok := p.resetLocks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		p.resetLocks[key] = lock
+	}
+	return lock
+}
+
+// failedPlayers - Progress that forwards every outcome and remembers the players that failed
+type failedPlayers struct {
+	Progress
+	mu  sync.Mutex
+	ids []int
+}
+
+// PlayerDone - Forward the outcome and record failures
+func (f *failedPlayers) PlayerDone(playerID int, err error) {
+	if err != nil {
+		f.mu.Lock()
+		f.ids = append(f.ids, playerID)
+		f.mu.Unlock()
+	}
+	f.Progress.PlayerDone(playerID, err)
+}
+
+// IDs - Players that failed so far
+func (f *failedPlayers) IDs() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int(nil), f.ids...)
+}
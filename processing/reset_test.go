@@ -0,0 +1,58 @@
+package processing
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+func TestNextReset(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		schedule store.ResetSchedule
+		loc      *time.Location
+		after    time.Time
+		want     time.Time
+	}{
+		{"daily later today", store.ResetSchedule{Time: "04:00"}, time.UTC, time.Date(2021, 1, 10, 3, 0, 0, 0, time.UTC), time.Date(2021, 1, 10, 4, 0, 0, 0, time.UTC)},
+		{"daily at the reset time", store.ResetSchedule{Time: "04:00"}, time.UTC, time.Date(2021, 1, 10, 4, 0, 0, 0, time.UTC), time.Date(2021, 1, 11, 4, 0, 0, 0, time.UTC)},
+		{"daily in the clan timezone", store.ResetSchedule{Time: "23:30"}, newYork, time.Date(2021, 1, 11, 3, 0, 0, 0, time.UTC), time.Date(2021, 1, 11, 4, 30, 0, 0, time.UTC)},
+		{"weekly later this week", store.ResetSchedule{Weekday: "friday", Time: "18:00"}, time.UTC, time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC), time.Date(2021, 1, 15, 18, 0, 0, 0, time.UTC)},
+		{"weekly short and mixed case", store.ResetSchedule{Weekday: "Mon", Time: "04:00"}, time.UTC, time.Date(2021, 1, 11, 5, 0, 0, 0, time.UTC), time.Date(2021, 1, 18, 4, 0, 0, 0, time.UTC)},
+		// Local reset time stays the same across daylight saving changes, so the UTC time moves
+		{"daily across spring forward", store.ResetSchedule{Time: "04:00"}, newYork, time.Date(2021, 3, 13, 10, 0, 0, 0, time.UTC), time.Date(2021, 3, 14, 8, 0, 0, 0, time.UTC)},
+		{"daily across fall back", store.ResetSchedule{Time: "04:00"}, newYork, time.Date(2021, 11, 6, 9, 0, 0, 0, time.UTC), time.Date(2021, 11, 7, 9, 0, 0, 0, time.UTC)},
+		{"weekly across spring forward", store.ResetSchedule{Weekday: "sunday", Time: "12:00"}, newYork, time.Date(2021, 3, 8, 0, 0, 0, 0, time.UTC), time.Date(2021, 3, 14, 16, 0, 0, 0, time.UTC)},
+		// 02:30 does not exist on the spring forward day and is moved past the gap
+		{"time skipped by spring forward", store.ResetSchedule{Time: "02:30"}, newYork, time.Date(2021, 3, 14, 5, 0, 0, 0, time.UTC), time.Date(2021, 3, 14, 7, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextReset(tt.schedule, tt.loc, tt.after)
+			if err != nil {
+				t.Fatalf("NextReset() error = %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextReset() = %v, want %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNextResetInvalid(t *testing.T) {
+	for _, schedule := range []store.ResetSchedule{
+		{Time: "25:00"},
+		{Time: "4pm"},
+		{Weekday: "someday", Time: "04:00"},
+	} {
+		if got, err := NextReset(schedule, time.UTC, time.Now()); err == nil {
+			t.Errorf("NextReset(%+v) = %v, want an error", schedule, got)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package processing
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// ClanLocation - Time zone used for a clan's daily rollups, UTC when the clan has none set
+func ClanLocation(clanData store.Clan) (*time.Location, error) {
+	if clanData.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(clanData.Timezone)
+}
+
+// RollupClanActivity - Recompute daily rollups for every day from from to to, in the clan time zone
+// Battles between two snapshots are counted on the day of the later snapshot
+func (p *Processor) RollupClanActivity(ctx context.Context, clanData store.Clan, from, to time.Time) error {
+	loc, err := ClanLocation(clanData)
+	if err != nil {
+		return err
+	}
+	firstDay := startOfDay(from, loc)
+	lastDay := startOfDay(to, loc)
+	var dates []string
+	for day := firstDay; !day.After(lastDay); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format("2006-01-02"))
+	}
+	end := lastDay.AddDate(0, 0, 1)
+
+	snapshots, err := p.db.GetSnapshots(ctx, store.SnapshotFilter{ClanID: clanData.ID, Realm: clanData.Realm, From: firstDay, To: end})
+	if err != nil {
+		return err
+	}
+	history := make(map[int][]store.Snapshot)
+	var playerIDs []int
+	for _, snapshot := range snapshots {
+		if _, ok := history[snapshot.PlayerID]; !ok {
+			playerIDs = append(playerIDs, snapshot.PlayerID)
+		}
+		history[snapshot.PlayerID] = append(history[snapshot.PlayerID], snapshot)
+	}
+	if len(playerIDs) > 0 {
+		// Starting totals come from each player's last snapshot before the first day, however old it is
+		starts, err := p.db.GetLatestSnapshots(ctx, store.SnapshotFilter{ClanID: clanData.ID, Realm: clanData.Realm, PlayerIDs: playerIDs, To: firstDay})
+		if err != nil {
+			return err
+		}
+		for _, start := range starts {
+			history[start.PlayerID] = append([]store.Snapshot{start}, history[start.PlayerID]...)
+		}
+	}
+
+	now := time.Now().UTC()
+	clanDays := make(map[string]*store.DailyActivity, len(dates))
+	for _, date := range dates {
+		clanDays[date] = &store.DailyActivity{ClanID: clanData.ID, Realm: clanData.Realm, Date: date, UpdatedAt: now}
+	}
+
+	var rows []store.DailyActivity
+	for _, pid := range playerIDs {
+		playerDays := make(map[string]*store.DailyActivity, len(dates))
+		for _, date := range dates {
+			playerDays[date] = &store.DailyActivity{ClanID: clanData.ID, Realm: clanData.Realm, PlayerID: pid, Date: date, UpdatedAt: now}
+		}
+
+		// Players with only older snapshots are no longer refreshed with this clan and were not loaded
+		var prev *store.Snapshot
+		for i, snapshot := range history[pid] {
+			if prev != nil && !snapshot.Timestamp.Before(firstDay) {
+				day := playerDays[snapshot.Timestamp.In(loc).Format("2006-01-02")]
+				day.Battles += delta(snapshot.Battles, prev.Battles)
+				day.Wins += delta(snapshot.Wins, prev.Wins)
+				day.Damage += delta(snapshot.Damage, prev.Damage)
+			}
+			prev = &history[pid][i]
+		}
+
+		for _, date := range dates {
+			day := playerDays[date]
+			rows = append(rows, *day)
+			if day.Battles > 0 {
+				clanDay := clanDays[date]
+				clanDay.Battles += day.Battles
+				clanDay.Wins += day.Wins
+				clanDay.Damage += day.Damage
+				clanDay.Players++
+			}
+		}
+	}
+	for _, date := range dates {
+		rows = append(rows, *clanDays[date])
+	}
+	return p.db.UpdateDailyActivity(ctx, rows)
+}
+
+// RollupAll - Recompute rollups from from to to for every enrolled clan
+func (p *Processor) RollupAll(ctx context.Context, from, to time.Time) {
+	clans, err := p.db.ListClans(ctx)
+	if err != nil {
+		log.Println("Failed to list clans for rollups:", err)
+		return
+	}
+	for _, clanData := range clans {
+		if err := p.RollupClanActivity(ctx, clanData, from, to); err != nil {
+			log.Println("Failed to roll up activity for", clanData.ClanTag, err)
+		}
+	}
+}
+
+// RunRollups - Recompute rollups for the current and previous day right away and then every interval until ctx is cancelled
+func (p *Processor) RunRollups(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		p.RollupAll(ctx, now.AddDate(0, 0, -1), now)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startOfDay - Midnight of the day t falls on in loc
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// delta - Growth of a running total, snapshots without a previous value or with a reset count as zero
+func delta(current, previous int) int {
+	if previous == 0 || current < previous {
+		return 0
+	}
+	return current - previous
+}
@@ -0,0 +1,84 @@
+package processing
+
+import (
+	"context"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/cufee/am-clanactivity/config"
+	"github.com/cufee/am-clanactivity/store"
+	"github.com/cufee/am-clanactivity/store/memory"
+)
+
+func TestRollupClanActivity(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	p := New(db, nil, config.ProcessingConfig{MaxConcurrentPlayers: 1, MaxConcurrentVehicles: 1})
+
+	// Tokyo is UTC+9, 15:00 UTC is midnight there
+	clanData := store.Clan{ID: 10, Realm: "NA", ClanTag: "TZ", Timezone: "Asia/Tokyo", MembersIds: []int{1, 2}}
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2021, month, day, hour, min, 0, 0, time.UTC)
+	}
+	for _, snapshot := range []store.Snapshot{
+		// Older snapshots only provide the starting totals
+		{PlayerID: 1, Realm: "NA", ClanID: 10, Timestamp: utc(2, 20, 12, 0), Battles: 90, Wins: 45},
+		{PlayerID: 1, Realm: "NA", ClanID: 10, Timestamp: utc(3, 1, 10, 0), Battles: 100, Wins: 50},
+		{PlayerID: 1, Realm: "NA", ClanID: 10, Timestamp: utc(3, 1, 14, 0), Battles: 110, Wins: 56},
+		{PlayerID: 1, Realm: "NA", ClanID: 10, Timestamp: utc(3, 1, 16, 0), Battles: 125, Wins: 60},
+		{PlayerID: 2, Realm: "NA", ClanID: 10, Timestamp: utc(2, 27, 12, 0), Battles: 40, Wins: 20},
+		{PlayerID: 2, Realm: "NA", ClanID: 10, Timestamp: utc(3, 1, 15, 30), Battles: 50, Wins: 21},
+		// Another clan is not counted
+		{PlayerID: 3, Realm: "NA", ClanID: 11, Timestamp: utc(2, 20, 12, 0), Battles: 10},
+		{PlayerID: 3, Realm: "NA", ClanID: 11, Timestamp: utc(3, 1, 12, 0), Battles: 20},
+	} {
+		if err := db.AddSnapshot(ctx, snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.RollupClanActivity(ctx, clanData, utc(3, 1, 3, 0), utc(3, 1, 16, 0)); err != nil {
+		t.Fatalf("RollupClanActivity() error = %v", err)
+	}
+	rows, err := db.GetDailyActivity(ctx, store.DailyActivityFilter{ClanID: 10, Realm: "NA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type key struct {
+		playerID int
+		date     string
+	}
+	got := make(map[key]store.DailyActivity)
+	for _, row := range rows {
+		got[key{row.PlayerID, row.Date}] = row
+	}
+	tests := []struct {
+		name    string
+		key     key
+		battles int
+		wins    int
+		players int
+	}{
+		{"player before local midnight", key{1, "2021-03-01"}, 20, 11, 0},
+		{"player after local midnight", key{1, "2021-03-02"}, 15, 4, 0},
+		{"player without battles on a day", key{2, "2021-03-01"}, 0, 0, 0},
+		{"player starting from an older snapshot", key{2, "2021-03-02"}, 10, 1, 0},
+		{"clan", key{0, "2021-03-01"}, 20, 11, 1},
+		{"clan after local midnight", key{0, "2021-03-02"}, 25, 5, 2},
+	}
+	for _, tt := range tests {
+		row, ok := got[tt.key]
+		if !ok {
+			t.Errorf("%s: no rollup for player %d on %s", tt.name, tt.key.playerID, tt.key.date)
+			continue
+		}
+		if row.Battles != tt.battles || row.Wins != tt.wins || row.Players != tt.players {
+			t.Errorf("%s: rollup = %+v, want %d battles, %d wins and %d players", tt.name, row, tt.battles, tt.wins, tt.players)
+		}
+	}
+	if len(rows) != 6 {
+		t.Errorf("RollupClanActivity() saved %d rows, want 2 days for 2 players and the clan", len(rows))
+	}
+}
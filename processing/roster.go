@@ -0,0 +1,125 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// RosterChanges - Members who joined or left a clan since the last roster sync
+type RosterChanges struct {
+	Joined []store.MemberEvent `json:"joined"`
+	Left   []store.MemberEvent `json:"left"`
+}
+
+// SyncClanRoster - Compare the live clan roster with the stored one, add new members, mark departed ones and record both as events
+func (p *Processor) SyncClanRoster(ctx context.Context, clanData store.Clan) (RosterChanges, error) {
+	changes := RosterChanges{Joined: []store.MemberEvent{}, Left: []store.MemberEvent{}}
+
+	realm, err := wgapi.ParseRealm(clanData.Realm)
+	if err != nil {
+		return changes, err
+	}
+	details, err := p.wg.GetClanDataByID(ctx, realm, clanData.ID)
+	if err != nil {
+		return changes, err
+	}
+	r, err := rating.Get(rating.Default)
+	if err != nil {
+		return changes, err
+	}
+
+	current := make(map[int]bool, len(details.MembersIds))
+	for _, pid := range details.MembersIds {
+		current[pid] = true
+	}
+	previous := make(map[int]bool, len(clanData.MembersIds))
+	for _, pid := range clanData.MembersIds {
+		previous[pid] = true
+	}
+	now := time.Now().UTC()
+
+	// New members get a player record and a session baseline, same as at enrollment
+	group := p.players.Group(ctx, nil)
+	for _, pid := range details.MembersIds {
+		if previous[pid] {
+			continue
+		}
+		member := details.Members[strconv.Itoa(pid)]
+		member.ID = pid
+		changes.Joined = append(changes.Joined, store.MemberEvent{ClanID: clanData.ID, Realm: clanData.Realm, PlayerID: pid, Nickname: member.Nickname, Type: store.MemberJoined, Timestamp: now})
+
+		group.Go(pid, func(ctx context.Context) error {
+			return p.addMember(ctx, r, realm, clanData.ID, member)
+		})
+	}
+	for _, err := range group.Wait() {
+		log.Println(err)
+	}
+
+	// Roles of members who stayed can change between syncs
+	for _, pid := range details.MembersIds {
+		member, ok := details.Members[strconv.Itoa(pid)]
+		if !previous[pid] || !ok {
+			continue
+		}
+		if err := p.updateRole(ctx, clanData.Realm, pid, member.Role); err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Println(err)
+		}
+	}
+
+	// Departed members keep their record and history, they are only marked as gone
+	for _, pid := range clanData.MembersIds {
+		if current[pid] {
+			continue
+		}
+		event := store.MemberEvent{ClanID: clanData.ID, Realm: clanData.Realm, PlayerID: pid, Type: store.MemberLeft, Timestamp: now}
+		playerData, err := p.db.GetPlayer(ctx, store.PlayerFilter{ID: pid, Realm: clanData.Realm})
+		if err == nil {
+			event.Nickname = playerData.Nickname
+			playerData.LeftAt = &now
+			err = p.db.UpdatePlayer(ctx, playerData, false)
+		}
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Println(err)
+		}
+		changes.Left = append(changes.Left, event)
+	}
+
+	// Settings like the time zone can change during the sync, so only the roster fields of the stored clan are replaced
+	stored, err := p.db.GetClan(ctx, store.ClanFilter{ID: clanData.ID, Realm: clanData.Realm})
+	if err != nil {
+		return changes, err
+	}
+	stored.ClanName = details.ClanName
+	stored.ClanTag = details.ClanTag
+	stored.MembersIds = details.MembersIds
+	if err := p.db.UpdateClan(ctx, stored, false); err != nil {
+		return changes, err
+	}
+
+	events := append(append([]store.MemberEvent{}, changes.Joined...), changes.Left...)
+	if err := p.db.AddMemberEvents(ctx, events); err != nil {
+		return changes, err
+	}
+	return changes, nil
+}
+
+// updateRole - Save the clan role of a member when it changed
+func (p *Processor) updateRole(ctx context.Context, realm string, playerID int, role string) error {
+	playerData, err := p.db.GetPlayer(ctx, store.PlayerFilter{ID: playerID, Realm: realm})
+	if err != nil {
+		return err
+	}
+	if playerData.Role == role {
+		return nil
+	}
+	playerData.Role = role
+	return p.db.UpdatePlayer(ctx, playerData, false)
+}
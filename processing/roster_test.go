@@ -0,0 +1,64 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+func TestSyncClanRosterKeepsSettings(t *testing.T) {
+	ctx := context.Background()
+	clanData := store.Clan{ID: 10, Realm: "NA", ClanTag: "OLD", MembersIds: []int{1001, 1002}}
+
+	var db store.Store
+	p, memoryDB := newTestProcessor(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wotb/clans/info/" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		// Settings are changed while the sync is running
+		changed := clanData
+		changed.Timezone = "Europe/Berlin"
+		changed.ResetSchedule = &store.ResetSchedule{Time: "04:00"}
+		if err := db.UpdateClan(ctx, changed, false); err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, `{"status":"ok","data":{"10":{"clan_id":10,"name":"New name","tag":"NEW","members_ids":[1001],"members":{"1001":{"account_id":1001,"account_name":"stays","role":"officer"}}}}}`)
+	})
+	db = memoryDB
+	if err := db.UpdateClan(ctx, clanData, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, pid := range clanData.MembersIds {
+		if err := db.UpdatePlayer(ctx, store.Player{ID: pid, Realm: "NA", ClanID: 10, Role: "private"}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, err := p.SyncClanRoster(ctx, clanData)
+	if err != nil {
+		t.Fatalf("SyncClanRoster() error = %v", err)
+	}
+	if len(changes.Joined) != 0 || len(changes.Left) != 1 || changes.Left[0].PlayerID != 1002 {
+		t.Errorf("SyncClanRoster() = %+v, want player 1002 gone", changes)
+	}
+
+	stored, err := db.GetClan(ctx, store.ClanFilter{ID: 10, Realm: "NA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ClanTag != "NEW" || stored.ClanName != "New name" || len(stored.MembersIds) != 1 {
+		t.Errorf("SyncClanRoster() stored %+v, want the live name, tag and members", stored)
+	}
+	if stored.Timezone != "Europe/Berlin" || stored.ResetSchedule == nil || stored.ResetSchedule.Time != "04:00" {
+		t.Errorf("SyncClanRoster() stored %+v, want settings changed during the sync kept", stored)
+	}
+	player, err := db.GetPlayer(ctx, store.PlayerFilter{ID: 1001, Realm: "NA"})
+	if err != nil || player.Role != "officer" {
+		t.Errorf("SyncClanRoster() member = %+v, %v, want the new role", player, err)
+	}
+}
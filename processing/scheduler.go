@@ -0,0 +1,296 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// schedulerRetry - Wait before trying again when clans can not be loaded
+const schedulerRetry = time.Minute
+
+// Scheduler - Background roster sync, session refresh and scheduled resets of every enrolled clan
+// Each clan keeps its own slot in the interval so WG requests are spread out instead of bursting.
+// Clans are refreshed one at a time, so a slow clan delays the clans due after it, LastLag on each
+// clan schedule shows how late its last refresh started
+type Scheduler struct {
+	p        *Processor
+	interval time.Duration
+	// now - Current time, replaced in tests
+	now func() time.Time
+
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	stopping chan struct{}
+	done     chan struct{}
+	current  int
+}
+
+// SchedulerStatus - Scheduler state and per-clan run times
+type SchedulerStatus struct {
+	Running     bool                 `json:"running"`
+	Interval    time.Duration        `json:"interval_ns"`
+	CurrentClan int                  `json:"current_clan,omitempty"`
+	Clans       []store.ClanSchedule `json:"clans"`
+}
+
+// NewScheduler - Create a scheduler that refreshes every clan once per interval
+func NewScheduler(p *Processor, interval time.Duration) *Scheduler {
+	return &Scheduler{p: p, interval: interval, now: time.Now}
+}
+
+// Start - Run the scheduler in the background until Stop is called or ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done != nil {
+		return
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.stopping = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run(ctx, s.stopping, s.done)
+	log.Println("Started scheduler, refreshing every clan every", s.interval)
+}
+
+// Stop - Cancel the clan being refreshed and wait for the scheduler to exit
+// The interrupted clan keeps its next run time and is picked up again on the next start
+func (s *Scheduler) Stop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Shutdown(ctx)
+}
+
+// Shutdown - Stop starting new clans and let the clan being refreshed finish until ctx is done, then cancel it
+func (s *Scheduler) Shutdown(ctx context.Context) {
+	s.mu.Lock()
+	cancel, stopping, done := s.cancel, s.stopping, s.done
+	s.cancel, s.stopping, s.done = nil, nil, nil
+	s.mu.Unlock()
+	if done == nil {
+		return
+	}
+
+	close(stopping)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("Scheduler did not finish in time, cancelling the current clan")
+	}
+	cancel()
+	<-done
+	log.Println("Stopped scheduler")
+}
+
+// Status - Current scheduler state with the last and next run of every clan
+func (s *Scheduler) Status(ctx context.Context) (SchedulerStatus, error) {
+	s.mu.Lock()
+	status := SchedulerStatus{Running: s.done != nil, Interval: s.interval, CurrentClan: s.current}
+	s.mu.Unlock()
+
+	schedules, err := s.p.db.ListClanSchedules(ctx)
+	if err != nil {
+		return status, err
+	}
+	if schedules == nil {
+		schedules = []store.ClanSchedule{}
+	}
+	status.Clans = schedules
+	return status, nil
+}
+
+// run - Refresh due clans and sleep until the next one is due
+func (s *Scheduler) run(ctx context.Context, stopping, done chan struct{}) {
+	defer close(done)
+	for {
+		timer := time.NewTimer(s.tick(ctx, stopping))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-stopping:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// tick - Refresh every clan that is due and return how long to wait for the next one
+// Clans that did not start yet are left for the next start once stopping is closed
+func (s *Scheduler) tick(ctx context.Context, stopping chan struct{}) time.Duration {
+	clans, err := s.p.db.ListClans(ctx)
+	if err != nil {
+		log.Println("Scheduler failed to list clans:", err)
+		return schedulerRetry
+	}
+	schedules, err := s.p.db.ListClanSchedules(ctx)
+	if err != nil {
+		log.Println("Scheduler failed to list schedules:", err)
+		return schedulerRetry
+	}
+	byClan := make(map[string]store.ClanSchedule, len(schedules))
+	for _, schedule := range schedules {
+		byClan[store.RecordKey(schedule.Realm, schedule.ClanID)] = schedule
+	}
+
+	// Clans seen for the first time are spread evenly across the interval
+	var unscheduled []store.Clan
+	for _, clanData := range clans {
+		if _, ok := byClan[store.RecordKey(clanData.Realm, clanData.ID)]; !ok {
+			unscheduled = append(unscheduled, clanData)
+		}
+	}
+	now := s.now().UTC()
+	for i, clanData := range unscheduled {
+		offset := s.interval * time.Duration(i) / time.Duration(len(unscheduled))
+		schedule := store.ClanSchedule{ClanID: clanData.ID, Realm: clanData.Realm, NextRun: now.Add(offset)}
+		if err := s.p.db.UpdateClanSchedule(ctx, schedule); err != nil {
+			log.Println(err)
+		}
+		byClan[store.RecordKey(clanData.Realm, clanData.ID)] = schedule
+	}
+
+	next := now.Add(s.interval)
+	for _, clanData := range clans {
+		select {
+		case <-stopping:
+			return 0
+		default:
+		}
+		schedule := byClan[store.RecordKey(clanData.Realm, clanData.ID)]
+		changed := false
+
+		// Archive and reset sessions on the clan's reset schedule
+		nextReset, err := s.nextReset(clanData, schedule)
+		if err != nil {
+			log.Println("Invalid reset schedule for", clanData.ClanTag, err)
+		}
+		if !nextReset.IsZero() && !nextReset.After(s.now()) {
+			err := s.resetClan(ctx, clanData)
+			if ctx.Err() != nil {
+				return 0
+			}
+			schedule.LastReset = s.now().UTC()
+			schedule.LastError = ""
+			if err != nil {
+				log.Println("Scheduled reset failed for", clanData.ClanTag, err)
+				schedule.LastError = "reset: " + err.Error()
+			}
+			nextReset, _ = s.nextReset(clanData, schedule)
+			changed = true
+		}
+		if !schedule.NextReset.Equal(nextReset) {
+			schedule.NextReset = nextReset
+			changed = true
+		}
+		if !nextReset.IsZero() && nextReset.Before(next) {
+			next = nextReset
+		}
+
+		if !schedule.NextRun.After(s.now()) {
+			start := s.now().UTC()
+			err := s.runClan(ctx, clanData)
+			if ctx.Err() != nil {
+				return 0
+			}
+			schedule.LastRun = start
+			schedule.LastLag = start.Sub(schedule.NextRun)
+			schedule.LastDuration = s.now().Sub(start)
+			schedule.LastError = ""
+			if err != nil {
+				log.Println("Scheduled refresh failed for", clanData.ClanTag, err)
+				schedule.LastError = err.Error()
+			}
+			// Stay in the same slot, unless the run took so long that the slot already passed
+			schedule.NextRun = schedule.NextRun.Add(s.interval)
+			if !schedule.NextRun.After(s.now()) {
+				schedule.NextRun = s.now().UTC().Add(s.interval)
+			}
+			changed = true
+		}
+		if schedule.NextRun.Before(next) {
+			next = schedule.NextRun
+		}
+
+		if changed {
+			if err := s.p.db.UpdateClanSchedule(ctx, schedule); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	return next.Sub(s.now())
+}
+
+// runClan - Sync the roster of a clan and refresh sessions of all members
+func (s *Scheduler) runClan(ctx context.Context, clanData store.Clan) error {
+	s.setCurrent(clanData.ID)
+	defer s.setCurrent(0)
+
+	// A failed roster sync should not stop the refresh of known members
+	_, syncErr := s.p.SyncClanRoster(ctx, clanData)
+	if syncErr != nil {
+		log.Println("Roster sync failed for", clanData.ClanTag, syncErr)
+	}
+	clanData, err := s.p.db.GetClan(ctx, store.ClanFilter{ID: clanData.ID, Realm: clanData.Realm})
+	if err != nil {
+		return err
+	}
+	realm, err := wgapi.ParseRealm(clanData.Realm)
+	if err != nil {
+		return err
+	}
+	r, err := rating.Get(rating.Default)
+	if err != nil {
+		return err
+	}
+
+	// Refreshing records a snapshot for every member, which is what the daily rollups are built from
+	players := make(chan store.Player, len(clanData.MembersIds))
+	s.p.PlayersFefreshSession(ctx, clanData.MembersIds, realm, RefreshOptions{Rating: r, ClanID: clanData.ID}, players)
+	for range players {
+	}
+	if syncErr != nil {
+		return fmt.Errorf("roster sync: %w", syncErr)
+	}
+	return nil
+}
+
+// resetClan - Archive and reset the session of a clan
+func (s *Scheduler) resetClan(ctx context.Context, clanData store.Clan) error {
+	s.setCurrent(clanData.ID)
+	defer s.setCurrent(0)
+
+	_, err := s.p.ResetClanSession(ctx, clanData)
+	return err
+}
+
+// nextReset - When the clan session is due to be reset next, zero without a reset schedule
+func (s *Scheduler) nextReset(clanData store.Clan, schedule store.ClanSchedule) (time.Time, error) {
+	if clanData.ResetSchedule == nil {
+		return time.Time{}, nil
+	}
+	loc, err := ClanLocation(clanData)
+	if err != nil {
+		return time.Time{}, err
+	}
+	after := clanData.ResetSchedule.Since
+	if schedule.LastReset.After(after) {
+		after = schedule.LastReset
+	}
+	return NextReset(*clanData.ResetSchedule, loc, after)
+}
+
+// setCurrent - Record which clan is being refreshed
+func (s *Scheduler) setCurrent(clanID int) {
+	s.mu.Lock()
+	s.current = clanID
+	s.mu.Unlock()
+}
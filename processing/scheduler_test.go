@@ -0,0 +1,121 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+func TestSchedulerTick(t *testing.T) {
+	ctx := context.Background()
+	p, db := newTestProcessor(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wotb/clans/info/" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		id := r.URL.Query().Get("clan_id")
+		fmt.Fprintf(w, `{"status":"ok","data":{"%s":{"clan_id":%s,"tag":"C%s","members_ids":[],"members":{}}}}`, id, id, id)
+	})
+	for _, id := range []int{1, 2, 3} {
+		if err := db.UpdateClan(ctx, store.Clan{ID: id, Realm: "NA", ClanTag: fmt.Sprintf("C%d", id)}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	interval := 30 * time.Minute
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewScheduler(p, interval)
+	s.now = func() time.Time { return now }
+
+	schedules := func() map[int]store.ClanSchedule {
+		list, err := db.ListClanSchedules(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byClan := make(map[int]store.ClanSchedule, len(list))
+		for _, schedule := range list {
+			byClan[schedule.ClanID] = schedule
+		}
+		return byClan
+	}
+
+	// New clans get slots spread across the interval and the first one is due right away
+	if wait := s.tick(ctx, make(chan struct{})); wait != 10*time.Minute {
+		t.Errorf("first tick waits %v, want 10m for the second slot", wait)
+	}
+	got := schedules()
+	for id, want := range map[int]time.Time{1: now.Add(interval), 2: now.Add(10 * time.Minute), 3: now.Add(20 * time.Minute)} {
+		if !got[id].NextRun.Equal(want) {
+			t.Errorf("clan %d next run = %v, want %v", id, got[id].NextRun, want)
+		}
+	}
+	if !got[1].LastRun.Equal(now) || !got[2].LastRun.IsZero() {
+		t.Errorf("first tick ran clan 1 at %v and clan 2 at %v, want only clan 1", got[1].LastRun, got[2].LastRun)
+	}
+
+	// A late tick keeps the clan in its slot and records the lag
+	now = now.Add(12 * time.Minute)
+	if wait := s.tick(ctx, make(chan struct{})); wait != 8*time.Minute {
+		t.Errorf("second tick waits %v, want 8m for the third slot", wait)
+	}
+	got = schedules()
+	if !got[2].NextRun.Equal(now.Add(-2*time.Minute).Add(interval)) || got[2].LastLag != 2*time.Minute {
+		t.Errorf("clan 2 schedule = %+v, want the same slot next interval and a 2m lag", got[2])
+	}
+
+	// Clans whose slot passed a whole interval ago move to a new slot
+	now = now.Add(2 * interval)
+	s.tick(ctx, make(chan struct{}))
+	got = schedules()
+	for id := 1; id <= 3; id++ {
+		if !got[id].NextRun.Equal(now.Add(interval)) || !got[id].LastRun.Equal(now) {
+			t.Errorf("clan %d schedule = %+v, want run now and next in one interval", id, got[id])
+		}
+	}
+
+	// Nothing is due before the next slot
+	now = now.Add(time.Minute)
+	if wait := s.tick(ctx, make(chan struct{})); wait != interval-time.Minute {
+		t.Errorf("tick without due clans waits %v, want %v", wait, interval-time.Minute)
+	}
+}
+
+func TestSchedulerTickReset(t *testing.T) {
+	ctx := context.Background()
+	p, db := newTestProcessor(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"ok","data":{"1":{"clan_id":1,"tag":"C1","members_ids":[],"members":{}}}}`)
+	})
+	now := time.Date(2021, 3, 1, 12, 30, 0, 0, time.UTC)
+	clanData := store.Clan{ID: 1, Realm: "NA", ClanTag: "C1", ResetSchedule: &store.ResetSchedule{Time: "12:00", Since: now.Add(-time.Hour)}}
+	if err := db.UpdateClan(ctx, clanData, true); err != nil {
+		t.Fatal(err)
+	}
+	// The refresh is not due, only the reset
+	if err := db.UpdateClanSchedule(ctx, store.ClanSchedule{ClanID: 1, Realm: "NA", NextRun: now.Add(20 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScheduler(p, time.Hour)
+	s.now = func() time.Time { return now }
+	if wait := s.tick(ctx, make(chan struct{})); wait != 20*time.Minute {
+		t.Errorf("tick waits %v, want 20m for the next refresh", wait)
+	}
+
+	schedules, err := db.ListClanSchedules(ctx)
+	if err != nil || len(schedules) != 1 {
+		t.Fatalf("ListClanSchedules() = %+v, %v", schedules, err)
+	}
+	schedule := schedules[0]
+	if !schedule.LastReset.Equal(now) || !schedule.NextReset.Equal(time.Date(2021, 3, 2, 12, 0, 0, 0, time.UTC)) || !schedule.LastRun.IsZero() {
+		t.Errorf("schedule after tick = %+v, want a reset now, the next one tomorrow and no refresh", schedule)
+	}
+	sessions, err := db.ListClanSessions(ctx, store.ClanSessionFilter{ClanID: 1, Realm: "NA"})
+	if err != nil || len(sessions) != 1 {
+		t.Errorf("ListClanSessions() = %+v, %v, want the archived session", sessions, err)
+	}
+}
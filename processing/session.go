@@ -0,0 +1,103 @@
+package processing
+
+import (
+	"context"
+	"math"
+	"time"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// startSession - Save current vehicle stats as the session baseline and reset session values on playerData
+// accountBattles is the account battle total fetched with or before vehicles, 0 when it is not known
+func (p *Processor) startSession(ctx context.Context, r rating.Rating, playerData *store.Player, vehicles []wgapi.VehicleStats, accountBattles int) error {
+	snapshot := store.VehicleSnapshot{
+		PlayerID:  playerData.ID,
+		Realm:     playerData.Realm,
+		Vehicles:  vehicles,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := p.db.UpdateVehicleSnapshot(ctx, snapshot); err != nil {
+		return err
+	}
+
+	battles := totalBattles(vehicles)
+	playerData.Battles = battles
+	playerData.AccountBattles = accountBattles
+	averageRating, err := p.averageRating(ctx, r, vehicles)
+	if err != nil {
+		return err
+	}
+	playerData.AverageRating = averageRating
+	playerData.RatingType = r.Name()
+	playerData.RatingBattles = battles
+	playerData.SessionBattles = 0
+	playerData.SessionRating = 0
+	playerData.SessionStats = &store.PlayerStats{}
+	playerData.CareerStats = calcPlayerStats(vehicles)
+	if last := lastBattleTime(vehicles); last > playerData.LastBattleTime {
+		playerData.LastBattleTime = last
+	}
+	return p.db.UpdatePlayer(ctx, *playerData, true)
+}
+
+// averageRating - Battle weighted rating across vehicles
+func (p *Processor) averageRating(ctx context.Context, r rating.Rating, vehicles []wgapi.VehicleStats) (int, error) {
+	if len(vehicles) == 0 {
+		return 0, nil
+	}
+	ratedBattles, rawRating, err := p.CalcVehicleRawRating(ctx, r, vehicles)
+	if err != nil || ratedBattles == 0 {
+		return 0, err
+	}
+	return int(math.Round(float64(rawRating) / float64(ratedBattles))), nil
+}
+
+// vehicleDeltas - Stats played on each vehicle since the baseline, vehicles without new battles are left out
+func vehicleDeltas(current, baseline []wgapi.VehicleStats) []wgapi.VehicleStats {
+	base := make(map[int]wgapi.VehicleStats, len(baseline))
+	for _, tank := range baseline {
+		base[tank.TankID] = tank
+	}
+
+	var deltas []wgapi.VehicleStats
+	for _, tank := range current {
+		delta := tank
+		delta.All = tank.All.Sub(base[tank.TankID].All)
+		if delta.All.Battles <= 0 {
+			continue
+		}
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
+
+// totalBattles - Sum of battles on all vehicles
+func totalBattles(vehicles []wgapi.VehicleStats) int {
+	var battles int
+	for _, tank := range vehicles {
+		battles += int(tank.All.Battles)
+	}
+	return battles
+}
+
+// lastBattleTime - Most recent battle on any vehicle as a unix timestamp
+func lastBattleTime(vehicles []wgapi.VehicleStats) int {
+	var last int
+	for _, tank := range vehicles {
+		if tank.LastBattleTime > last {
+			last = tank.LastBattleTime
+		}
+	}
+	return last
+}
+
+// ratingType - Rating stored on a player record, records without one were always rated with WN8
+func ratingType(playerData store.Player) string {
+	if playerData.RatingType == "" {
+		return rating.Default
+	}
+	return playerData.RatingType
+}
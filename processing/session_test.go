@@ -0,0 +1,178 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cufee/am-clanactivity/config"
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+	"github.com/cufee/am-clanactivity/store/memory"
+)
+
+// newTestProcessor - Processor on a memory store with averages for tanks 1 to 3, answering Wargaming requests with handler
+func newTestProcessor(t *testing.T, handler http.HandlerFunc) (*Processor, *memory.Store) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	db := memory.New()
+	for _, id := range []int{1, 2, 3} {
+		// Averages of 0.5 defense points, 1 frag, 1 spot and 1000 damage per battle at 50% winrate
+		var tank store.TankAverages
+		tank.TankID = id
+		tank.All.Battles = 1000
+		tank.All.DroppedCapturePoints = 500
+		tank.Special.DamagePerBattle = 1000
+		tank.Special.KillsPerBattle = 1
+		tank.Special.SpotsPerBattle = 1
+		tank.Special.Winrate = 50
+		db.PutTankAvg(tank)
+	}
+
+	wg := wgapi.NewClient("test", server.Client(), map[wgapi.Realm]string{wgapi.RealmNA: server.URL})
+	p := New(db, wg, config.ProcessingConfig{MaxConcurrentPlayers: 2, MaxConcurrentVehicles: 2})
+	if err := p.TankCache().Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return p, db
+}
+
+// vehiclesHandler - Answer vehicle stats requests with vehicles
+func vehiclesHandler(t *testing.T, vehicles []wgapi.VehicleStats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wotb/tanks/stats/" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "ok",
+			"data":   map[string][]wgapi.VehicleStats{r.URL.Query().Get("account_id"): vehicles},
+		})
+	}
+}
+
+// expectedTank - Battles played on a tank exactly at the test averages, rated 1565 WN8
+func expectedTank(id int, battles float64) wgapi.VehicleStats {
+	var tank wgapi.VehicleStats
+	tank.TankID = id
+	tank.All.Battles = battles
+	tank.All.Wins = battles / 2
+	tank.All.Frags = battles
+	tank.All.Spotted = battles
+	tank.All.DamageDealt = battles * 1000
+	tank.All.DroppedCapturePoints = battles / 2
+	return tank
+}
+
+func TestVehicleDeltas(t *testing.T) {
+	baseline := []wgapi.VehicleStats{expectedTank(1, 100), expectedTank(2, 50), expectedTank(3, 10)}
+	current := []wgapi.VehicleStats{expectedTank(1, 130), expectedTank(2, 50), expectedTank(3, 4), expectedTank(4, 7)}
+
+	deltas := vehicleDeltas(current, baseline)
+	battles := make(map[int]float64)
+	for _, tank := range deltas {
+		battles[tank.TankID] = tank.All.Battles
+	}
+	tests := []struct {
+		name   string
+		tankID int
+		want   float64
+		listed bool
+	}{
+		{"played", 1, 30, true},
+		{"not played", 2, 0, false},
+		{"fewer battles than the baseline", 3, 0, false},
+		{"new since the baseline", 4, 7, true},
+	}
+	for _, tt := range tests {
+		got, listed := battles[tt.tankID]
+		if listed != tt.listed || got != tt.want {
+			t.Errorf("%s: vehicleDeltas() tank %d = %v battles, listed %v, want %v, listed %v", tt.name, tt.tankID, got, listed, tt.want, tt.listed)
+		}
+	}
+	if damage := deltas[0].All.DamageDealt; damage != 30000 {
+		t.Errorf("vehicleDeltas() tank 1 damage = %v, want 30000", damage)
+	}
+	if len(vehicleDeltas(current, nil)) != len(current) {
+		t.Error("vehicleDeltas() without a baseline left out vehicles")
+	}
+}
+
+func TestSessionRating(t *testing.T) {
+	ctx := context.Background()
+	r, err := rating.Get("wn8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tank 1 was played, tank 2 has fewer battles than at session start and tank 3 is new
+	current := []wgapi.VehicleStats{expectedTank(1, 200), expectedTank(2, 40), expectedTank(3, 100)}
+	p, db := newTestProcessor(t, vehiclesHandler(t, current))
+
+	playerData := store.Player{ID: 1001, Realm: "NA", Battles: 150, RatingBattles: 150, RatingType: r.Name()}
+	if err := db.UpdatePlayer(ctx, playerData, true); err != nil {
+		t.Fatal(err)
+	}
+	baseline := []wgapi.VehicleStats{expectedTank(1, 100), expectedTank(2, 50)}
+	if err := db.UpdateVehicleSnapshot(ctx, store.VehicleSnapshot{PlayerID: 1001, Realm: "NA", Vehicles: baseline}); err != nil {
+		t.Fatal(err)
+	}
+
+	playerData, err = p.calcPlayerRating(ctx, wgapi.RealmNA, RefreshOptions{Rating: r, IncludeVehicles: true}, playerData, 0)
+	if err != nil {
+		t.Fatalf("calcPlayerRating() error = %v", err)
+	}
+	if playerData.SessionBattles != 200 {
+		t.Errorf("calcPlayerRating() session battles = %d, want 200 without the reset vehicle", playerData.SessionBattles)
+	}
+	if playerData.SessionRating != 1565 {
+		t.Errorf("calcPlayerRating() session rating = %d, want 1565", playerData.SessionRating)
+	}
+	if len(playerData.SessionVehicles) != 2 || playerData.SessionStats == nil || playerData.SessionStats.Battles != 200 {
+		t.Errorf("calcPlayerRating() session vehicles = %+v, stats %+v, want tanks 1 and 3", playerData.SessionVehicles, playerData.SessionStats)
+	}
+	snapshot, err := db.GetVehicleSnapshot(ctx, "NA", 1001)
+	if err != nil || len(snapshot.Vehicles) != 2 {
+		t.Errorf("calcPlayerRating() changed the session baseline to %+v, %v", snapshot, err)
+	}
+}
+
+func TestSessionRatingAccountReset(t *testing.T) {
+	ctx := context.Background()
+	r, err := rating.Get("wn8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fewer battles in total than at session start, the session starts over from the current stats
+	current := []wgapi.VehicleStats{expectedTank(1, 20)}
+	p, db := newTestProcessor(t, vehiclesHandler(t, current))
+
+	playerData := store.Player{ID: 1001, Realm: "NA", Battles: 150, RatingBattles: 150, RatingType: r.Name()}
+	if err := db.UpdatePlayer(ctx, playerData, true); err != nil {
+		t.Fatal(err)
+	}
+	baseline := []wgapi.VehicleStats{expectedTank(1, 100), expectedTank(2, 50)}
+	if err := db.UpdateVehicleSnapshot(ctx, store.VehicleSnapshot{PlayerID: 1001, Realm: "NA", Vehicles: baseline}); err != nil {
+		t.Fatal(err)
+	}
+
+	playerData, err = p.calcPlayerRating(ctx, wgapi.RealmNA, RefreshOptions{Rating: r}, playerData, 0)
+	if err != nil {
+		t.Fatalf("calcPlayerRating() error = %v", err)
+	}
+	if playerData.SessionBattles != 0 || playerData.SessionRating != 0 || playerData.Battles != 20 {
+		t.Errorf("calcPlayerRating() after a reset = %d session battles, rating %d, %d battles, want a new session at 20 battles", playerData.SessionBattles, playerData.SessionRating, playerData.Battles)
+	}
+	snapshot, err := db.GetVehicleSnapshot(ctx, "NA", 1001)
+	if err != nil || len(snapshot.Vehicles) != 1 || snapshot.Vehicles[0].All.Battles != 20 {
+		t.Errorf("calcPlayerRating() after a reset left the baseline at %+v, %v", snapshot, err)
+	}
+	stored, err := db.GetPlayer(ctx, store.PlayerFilter{ID: 1001, Realm: "NA"})
+	if err != nil || stored.Battles != 20 || stored.RatingBattles != 20 || stored.AverageRating != 1565 {
+		t.Errorf("calcPlayerRating() after a reset stored %+v, %v", stored, err)
+	}
+}
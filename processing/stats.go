@@ -0,0 +1,105 @@
+package processing
+
+import (
+	"math"
+	"sort"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// calcPlayerStats - Aggregate stats across vehicles
+func calcPlayerStats(vehicles []wgapi.VehicleStats) *store.PlayerStats {
+	var total wgapi.BattleStats
+	for _, tank := range vehicles {
+		total.Battles += tank.All.Battles
+		total.Wins += tank.All.Wins
+		total.DamageDealt += tank.All.DamageDealt
+		total.DamageReceived += tank.All.DamageReceived
+		total.Frags += tank.All.Frags
+		total.SurvivedBattles += tank.All.SurvivedBattles
+		total.Hits += tank.All.Hits
+		total.Shots += tank.All.Shots
+		total.Xp += tank.All.Xp
+	}
+
+	stats := &store.PlayerStats{
+		Battles:     int(total.Battles),
+		Wins:        int(total.Wins),
+		DamageDealt: int(total.DamageDealt),
+	}
+	if total.Battles == 0 {
+		return stats
+	}
+	stats.Winrate = round2(total.Wins / total.Battles * 100)
+	stats.AverageDamage = round2(total.DamageDealt / total.Battles)
+	stats.KillsPerBattle = round2(total.Frags / total.Battles)
+	stats.SurvivalRate = round2(total.SurvivedBattles / total.Battles * 100)
+	stats.AverageXP = round2(total.Xp / total.Battles)
+	if total.DamageReceived > 0 {
+		stats.DamageRatio = round2(total.DamageDealt / total.DamageReceived)
+	}
+	if total.Shots > 0 {
+		stats.HitRate = round2(total.Hits / total.Shots * 100)
+	}
+	return stats
+}
+
+// rateVehicle - Rate a vehicle with r, converting API stats and stored averages to rating inputs
+func rateVehicle(r rating.Rating, tank wgapi.VehicleStats, tankAvgData store.TankAverages) (float64, bool) {
+	stats := rating.VehicleStats{
+		Battles:              tank.All.Battles,
+		Wins:                 tank.All.Wins,
+		Frags:                tank.All.Frags,
+		DamageDealt:          tank.All.DamageDealt,
+		Spotted:              tank.All.Spotted,
+		CapturePoints:        tank.All.CapturePoints,
+		DroppedCapturePoints: tank.All.DroppedCapturePoints,
+	}
+	averages := rating.TankAverages{
+		Tier:                 tankAvgData.Tier,
+		Battles:              tankAvgData.All.Battles,
+		DroppedCapturePoints: tankAvgData.All.DroppedCapturePoints,
+		DamagePerBattle:      tankAvgData.Special.DamagePerBattle,
+		KillsPerBattle:       tankAvgData.Special.KillsPerBattle,
+		SpotsPerBattle:       tankAvgData.Special.SpotsPerBattle,
+		Winrate:              tankAvgData.Special.Winrate,
+	}
+	return r.Vehicle(stats, averages)
+}
+
+// round2 - Round to two decimal places
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// calcSessionVehicles - Per-vehicle breakdown of session deltas, most played first
+func (p *Processor) calcSessionVehicles(r rating.Rating, deltas []wgapi.VehicleStats) []store.SessionVehicle {
+	vehicles := make([]store.SessionVehicle, 0, len(deltas))
+	for _, tank := range deltas {
+		vehicle := store.SessionVehicle{
+			TankID:      tank.TankID,
+			Battles:     int(tank.All.Battles),
+			Wins:        int(tank.All.Wins),
+			DamageDealt: int(tank.All.DamageDealt),
+		}
+		if tank.All.Battles > 0 {
+			vehicle.Winrate = round2(tank.All.Wins / tank.All.Battles * 100)
+			vehicle.AverageDamage = round2(tank.All.DamageDealt / tank.All.Battles)
+		}
+		if tankAvgData, ok := p.tanks.Get(tank.TankID); ok {
+			vehicle.Name = tankAvgData.Name
+			vehicle.Tier = tankAvgData.Tier
+			vehicle.Nation = tankAvgData.Nation
+			if vehicleRating, ok := rateVehicle(r, tank, tankAvgData); ok {
+				vehicle.Rating = int(vehicleRating)
+			}
+		}
+		vehicles = append(vehicles, vehicle)
+	}
+	sort.SliceStable(vehicles, func(i, j int) bool {
+		return vehicles[i].Battles > vehicles[j].Battles
+	})
+	return vehicles
+}
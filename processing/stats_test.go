@@ -0,0 +1,100 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+func TestCalcPlayerStats(t *testing.T) {
+	played := func(battles, wins, damage, received, frags, survived, hits, shots, xp float64) wgapi.VehicleStats {
+		var tank wgapi.VehicleStats
+		tank.All = wgapi.BattleStats{Battles: battles, Wins: wins, DamageDealt: damage, DamageReceived: received, Frags: frags, SurvivedBattles: survived, Hits: hits, Shots: shots, Xp: xp}
+		return tank
+	}
+
+	tests := []struct {
+		name     string
+		vehicles []wgapi.VehicleStats
+		want     store.PlayerStats
+	}{
+		{"no vehicles", nil, store.PlayerStats{}},
+		{"no battles", []wgapi.VehicleStats{played(0, 0, 0, 0, 0, 0, 0, 0, 0)}, store.PlayerStats{}},
+		{
+			"across vehicles",
+			[]wgapi.VehicleStats{played(2, 1, 3000, 1000, 3, 1, 10, 20, 1500), played(1, 1, 1000, 1000, 0, 0, 5, 10, 600)},
+			store.PlayerStats{Battles: 3, Wins: 2, DamageDealt: 4000, Winrate: 66.67, AverageDamage: 1333.33, DamageRatio: 2, KillsPerBattle: 1, SurvivalRate: 33.33, HitRate: 50, AverageXP: 700},
+		},
+		{
+			"no damage received",
+			[]wgapi.VehicleStats{played(1, 1, 2000, 0, 2, 1, 3, 4, 900)},
+			store.PlayerStats{Battles: 1, Wins: 1, DamageDealt: 2000, Winrate: 100, AverageDamage: 2000, KillsPerBattle: 2, SurvivalRate: 100, HitRate: 75, AverageXP: 900},
+		},
+		{
+			"no shots",
+			[]wgapi.VehicleStats{played(4, 0, 0, 800, 0, 0, 0, 0, 400)},
+			store.PlayerStats{Battles: 4, AverageXP: 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calcPlayerStats(tt.vehicles)
+			if got == nil {
+				t.Fatal("calcPlayerStats() = nil")
+			}
+			for _, value := range []float64{got.Winrate, got.AverageDamage, got.DamageRatio, got.KillsPerBattle, got.SurvivalRate, got.HitRate, got.AverageXP} {
+				if math.IsNaN(value) || math.IsInf(value, 0) {
+					t.Fatalf("calcPlayerStats() = %+v, contains NaN or Inf", *got)
+				}
+			}
+			if *got != tt.want {
+				t.Errorf("calcPlayerStats() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAverageRatingWithoutRatedBattles(t *testing.T) {
+	p, _ := newTestProcessor(t, func(w http.ResponseWriter, r *http.Request) {})
+	wn8, err := rating.Get("wn8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		vehicles []wgapi.VehicleStats
+	}{
+		{"no vehicles", nil},
+		{"no averages for the tank", []wgapi.VehicleStats{expectedTank(99, 10)}},
+		{"no battles", []wgapi.VehicleStats{expectedTank(1, 0)}},
+	}
+	for _, tt := range tests {
+		if got, err := p.averageRating(context.Background(), wn8, tt.vehicles); got != 0 || err != nil {
+			t.Errorf("%s: averageRating() = %d, %v, want 0", tt.name, got, err)
+		}
+	}
+}
+
+func TestCalcVehicleRawRatingCanceled(t *testing.T) {
+	p, _ := newTestProcessor(t, func(w http.ResponseWriter, r *http.Request) {})
+	wn8, err := rating.Get("wn8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vehicles := []wgapi.VehicleStats{expectedTank(1, 10), expectedTank(2, 10), expectedTank(3, 10)}
+
+	if battles, raw, err := p.CalcVehicleRawRating(context.Background(), wn8, vehicles); err != nil || battles != 30 || raw != 30*1565 {
+		t.Errorf("CalcVehicleRawRating() = %d, %d, %v, want 30 battles rated 1565", battles, raw, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := p.CalcVehicleRawRating(ctx, wn8, vehicles); !errors.Is(err, context.Canceled) {
+		t.Errorf("CalcVehicleRawRating() with a canceled context error = %v, want context.Canceled", err)
+	}
+}
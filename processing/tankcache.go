@@ -0,0 +1,79 @@
+package processing
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// TankCache - Read-only in-memory copy of tank averages, replaced as a whole on refresh
+type TankCache struct {
+	db store.Store
+
+	mu       sync.RWMutex
+	tanks    map[int]store.TankAverages
+	loadedAt time.Time
+}
+
+// TankCacheStats - Current state of the tank averages cache
+type TankCacheStats struct {
+	Tanks    int       `json:"tanks"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// NewTankCache - Create an empty cache that loads tank averages from db
+func NewTankCache(db store.Store) *TankCache {
+	return &TankCache{db: db, tanks: make(map[int]store.TankAverages)}
+}
+
+// Refresh - Reload all tank averages from the store
+func (c *TankCache) Refresh(ctx context.Context) error {
+	tanks, err := c.db.ListTankAverages(ctx)
+	if err != nil {
+		return err
+	}
+	loaded := make(map[int]store.TankAverages, len(tanks))
+	for _, tank := range tanks {
+		loaded[tank.TankID] = tank
+	}
+
+	c.mu.Lock()
+	c.tanks = loaded
+	c.loadedAt = time.Now().UTC()
+	c.mu.Unlock()
+	return nil
+}
+
+// Run - Refresh the cache every interval until ctx is done
+func (c *TankCache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil {
+				log.Println("Failed to refresh tank averages:", err)
+			}
+		}
+	}
+}
+
+// Get - Averages data for a tank
+func (c *TankCache) Get(tankID int) (store.TankAverages, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tank, ok := c.tanks[tankID]
+	return tank, ok
+}
+
+// Stats - Number of cached tanks and last load time
+func (c *TankCache) Stats() TankCacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return TankCacheStats{Tanks: len(c.tanks), LoadedAt: c.loadedAt}
+}
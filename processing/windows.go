@@ -0,0 +1,77 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// ErrWindowExists - Returned when creating a tracking window with a name that is already used by the clan
+var ErrWindowExists = errors.New("tracking window already exists")
+
+// CreateTrackingWindow - Start a named tracking window for a clan, saving current vehicle stats of every member as its baseline
+// Members whose stats can not be loaded get their baseline on the first export of the window
+func (p *Processor) CreateTrackingWindow(ctx context.Context, clanData store.Clan, name string) (store.TrackingWindow, error) {
+	window := store.TrackingWindow{ClanID: clanData.ID, Realm: clanData.Realm, Name: name, CreatedAt: time.Now().UTC()}
+
+	_, err := p.db.GetTrackingWindow(ctx, clanData.Realm, clanData.ID, name)
+	if err == nil {
+		return window, fmt.Errorf("%s: %w", name, ErrWindowExists)
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return window, err
+	}
+	realm, err := wgapi.ParseRealm(clanData.Realm)
+	if err != nil {
+		return window, err
+	}
+	if err := p.db.UpdateTrackingWindow(ctx, window); err != nil {
+		return window, err
+	}
+
+	opts := RefreshOptions{ClanID: clanData.ID, Window: name}
+	group := p.players.Group(ctx, nil)
+	for _, pid := range clanData.MembersIds {
+		pid := pid
+		group.Go(pid, func(ctx context.Context) error {
+			vehicles, err := p.wg.GetVehicleStats(ctx, realm, pid)
+			if err != nil {
+				return err
+			}
+			return p.saveWindowBaseline(ctx, realm, opts, pid, vehicles)
+		})
+	}
+	for _, err := range group.Wait() {
+		log.Println(err)
+	}
+	return window, nil
+}
+
+// windowBaseline - Vehicle stats a player had when the tracking window started
+// Players without a baseline, or whose battle count went down, start the window now
+func (p *Processor) windowBaseline(ctx context.Context, realm wgapi.Realm, opts RefreshOptions, playerID int, vehicles []wgapi.VehicleStats) ([]wgapi.VehicleStats, error) {
+	snapshot, err := p.db.GetWindowSnapshot(ctx, string(realm), opts.ClanID, opts.Window, playerID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && totalBattles(vehicles) >= totalBattles(snapshot.Vehicles) {
+		return snapshot.Vehicles, nil
+	}
+	return vehicles, p.saveWindowBaseline(ctx, realm, opts, playerID, vehicles)
+}
+
+// saveWindowBaseline - Save vehicle stats as the tracking window baseline of a player
+func (p *Processor) saveWindowBaseline(ctx context.Context, realm wgapi.Realm, opts RefreshOptions, playerID int, vehicles []wgapi.VehicleStats) error {
+	return p.db.UpdateWindowSnapshot(ctx, store.WindowSnapshot{
+		ClanID:    opts.ClanID,
+		Realm:     string(realm),
+		Window:    opts.Window,
+		PlayerID:  playerID,
+		Vehicles:  vehicles,
+		CreatedAt: time.Now().UTC(),
+	})
+}
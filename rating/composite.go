@@ -0,0 +1,20 @@
+package rating
+
+import "math"
+
+// Composite - Damage and winrate relative to tank averages, 1000 is average
+type Composite struct{}
+
+// Name - Registry key
+func (Composite) Name() string { return "composite" }
+
+// Vehicle - Composite score for a single vehicle
+func (Composite) Vehicle(tank VehicleStats, tankAvgData TankAverages) (float64, bool) {
+	if tank.Battles == 0 || tankAvgData.DamagePerBattle == 0 || tankAvgData.Winrate == 0 {
+		return 0, false
+	}
+	rDmg := (tank.DamageDealt / tank.Battles) / tankAvgData.DamagePerBattle
+	rWr := (tank.Wins / tank.Battles * 100) / tankAvgData.Winrate
+
+	return math.Round(500*rDmg + 500*rWr), true
+}
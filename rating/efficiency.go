@@ -0,0 +1,36 @@
+package rating
+
+import "math"
+
+// Efficiency - Classic efficiency rating
+type Efficiency struct{}
+
+// Name - Registry key
+func (Efficiency) Name() string { return "eff" }
+
+// Vehicle - Efficiency for a single vehicle, using the tank tier from averages data
+func (Efficiency) Vehicle(tank VehicleStats, tankAvgData TankAverages) (float64, bool) {
+	if tank.Battles == 0 || tankAvgData.Tier == 0 {
+		return 0, false
+	}
+	tier := float64(tankAvgData.Tier)
+	battles := tank.Battles
+
+	frags := tank.Frags / battles
+	dmg := tank.DamageDealt / battles
+	spot := tank.Spotted / battles
+	capture := tank.CapturePoints / battles
+	def := tank.DroppedCapturePoints / battles
+
+	rating := dmg*(10/(tier+2))*(0.23+2*tier/100) +
+		frags*250 +
+		spot*150 +
+		math.Log(capture+1)/math.Log(1.732)*150 +
+		def*150
+
+	rating = math.Round(rating)
+	if math.IsNaN(rating) || math.IsInf(rating, 0) {
+		return 0, false
+	}
+	return rating, true
+}
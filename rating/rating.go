@@ -0,0 +1,102 @@
+package rating
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default - Rating used when none is selected
+const Default = "wn8"
+
+// Rating - Per-vehicle performance metric
+type Rating interface {
+	// Name - Key the rating is registered under
+	Name() string
+	// Vehicle - Score for a single vehicle, ok is false if the vehicle can not be rated
+	Vehicle(stats VehicleStats, averages TankAverages) (score float64, ok bool)
+}
+
+// VehicleStats - Totals played on a single vehicle
+type VehicleStats struct {
+	Battles              float64
+	Wins                 float64
+	Frags                float64
+	DamageDealt          float64
+	Spotted              float64
+	CapturePoints        float64
+	DroppedCapturePoints float64
+}
+
+// TankAverages - Averages of all players on a single tank, per battle values are what an average player does
+type TankAverages struct {
+	Tier                 int
+	Battles              float64
+	DroppedCapturePoints float64
+	DamagePerBattle      float64
+	KillsPerBattle       float64
+	SpotsPerBattle       float64
+	Winrate              float64
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Rating)
+)
+
+// Register - Make a rating available by name, replacing any rating with the same name
+func Register(r Rating) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(r.Name())] = r
+}
+
+// Get - Find a registered rating by name, an empty name returns the default rating
+func Get(name string) (Rating, error) {
+	if name == "" {
+		name = Default
+	}
+	RegisterBuiltin()
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("rating %s not found, available: %s", name, strings.Join(namesLocked(), ", "))
+	}
+	return r, nil
+}
+
+// Names - Names of all registered ratings
+func Names() []string {
+	RegisterBuiltin()
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return namesLocked()
+}
+
+func namesLocked() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// builtinOnce - Built in ratings are registered once, by RegisterBuiltin or on first lookup
+var builtinOnce sync.Once
+
+// RegisterBuiltin - Register all ratings shipped with this package, Get and Names do it on first use
+// Ratings registered before under the same name are kept
+func RegisterBuiltin() {
+	builtinOnce.Do(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		for _, r := range []Rating{WN8{}, WN7{}, Efficiency{}, Composite{}} {
+			if _, ok := registry[strings.ToLower(r.Name())]; !ok {
+				registry[strings.ToLower(r.Name())] = r
+			}
+		}
+	})
+}
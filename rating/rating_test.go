@@ -0,0 +1,54 @@
+package rating
+
+import (
+	"strings"
+	"testing"
+)
+
+// fixedRating - Rating that scores every vehicle the same
+type fixedRating struct {
+	name  string
+	score float64
+}
+
+func (r fixedRating) Name() string { return r.name }
+
+func (r fixedRating) Vehicle(stats VehicleStats, averages TankAverages) (float64, bool) {
+	return r.score, true
+}
+
+func TestGetBuiltinWithoutRegistering(t *testing.T) {
+	// Nothing in this package calls RegisterBuiltin, lookups register the built in ratings on first use
+	for _, name := range []string{"", "wn8", "WN7", "eff", "composite"} {
+		if _, err := Get(name); err != nil {
+			t.Errorf("Get(%q) error = %v", name, err)
+		}
+	}
+	r, err := Get("")
+	if err != nil || r.Name() != Default {
+		t.Errorf("Get(\"\") = %v, %v, want %s", r, err, Default)
+	}
+	if names := strings.Join(Names(), ","); names != "composite,eff,wn7,wn8" {
+		t.Errorf("Names() = %s, want every built in rating", names)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register(fixedRating{name: "Fixed", score: 42})
+	r, err := Get("fixed")
+	if err != nil {
+		t.Fatalf("Get(fixed) error = %v", err)
+	}
+	if score, _ := r.Vehicle(VehicleStats{}, TankAverages{}); score != 42 {
+		t.Errorf("Get(fixed).Vehicle() = %v, want 42", score)
+	}
+
+	// Calling RegisterBuiltin again does not replace registered ratings
+	RegisterBuiltin()
+	if _, err := Get("fixed"); err != nil {
+		t.Errorf("Get(fixed) after RegisterBuiltin error = %v", err)
+	}
+	if _, err := Get("missing"); err == nil || !strings.Contains(err.Error(), "fixed") {
+		t.Errorf("Get(missing) error = %v, want the available ratings listed", err)
+	}
+}
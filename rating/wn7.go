@@ -0,0 +1,37 @@
+package rating
+
+import "math"
+
+// WN7 - Older WN rating based on tier instead of expected values
+type WN7 struct{}
+
+// Name - Registry key
+func (WN7) Name() string { return "wn7" }
+
+// Vehicle - WN7 for a single vehicle, using the tank tier from averages data
+func (WN7) Vehicle(tank VehicleStats, tankAvgData TankAverages) (float64, bool) {
+	if tank.Battles == 0 || tankAvgData.Tier == 0 {
+		return 0, false
+	}
+	tier := float64(tankAvgData.Tier)
+	battles := tank.Battles
+
+	frags := tank.Frags / battles
+	dmg := tank.DamageDealt / battles
+	spot := tank.Spotted / battles
+	def := tank.DroppedCapturePoints / battles
+	wr := tank.Wins / battles * 100
+
+	rating := (1240-1040/math.Pow(math.Min(tier, 6), 0.164))*frags +
+		dmg*530/(184*math.Exp(0.24*tier)+130) +
+		spot*125*math.Min(tier, 3)/3 +
+		math.Min(def, 2.2)*100 +
+		((185/(0.17+math.Exp((wr-35)*-0.134)))-500)*0.45 -
+		((5-math.Min(tier, 5))*125)/(1+math.Exp((tier-math.Pow(battles/220, 3/tier))*1.5))
+
+	rating = math.Round(rating)
+	if math.IsNaN(rating) || math.IsInf(rating, 0) {
+		return 0, false
+	}
+	return rating, true
+}
@@ -0,0 +1,49 @@
+package rating
+
+import "math"
+
+// WN8 - Rating relative to expected values for each tank
+type WN8 struct{}
+
+// Name - Registry key
+func (WN8) Name() string { return "wn8" }
+
+// Vehicle - WN8 for a single vehicle
+func (WN8) Vehicle(tank VehicleStats, tankAvgData TankAverages) (float64, bool) {
+	if tankAvgData.Battles == 0 || tank.Battles == 0 {
+		return 0, false
+	}
+
+	// Expected values for WN8
+	expDef := tankAvgData.DroppedCapturePoints / tankAvgData.Battles
+	expFrag := tankAvgData.KillsPerBattle
+	expSpot := tankAvgData.SpotsPerBattle
+	expDmg := tankAvgData.DamagePerBattle
+	expWr := tankAvgData.Winrate
+
+	// Actual performance
+	pDef := tank.DroppedCapturePoints / tank.Battles
+	pFrag := tank.Frags / tank.Battles
+	pSpot := tank.Spotted / tank.Battles
+	pDmg := tank.DamageDealt / tank.Battles
+	pWr := tank.Wins / tank.Battles * 100
+
+	// Calculate WN8 metrics
+	rDef := pDef / expDef
+	rFrag := pFrag / expFrag
+	rSpot := pSpot / expSpot
+	rDmg := pDmg / expDmg
+	rWr := pWr / expWr
+
+	adjustedWr := math.Max(0, ((rWr - 0.71) / (1 - 0.71)))
+	adjustedDmg := math.Max(0, ((rDmg - 0.22) / (1 - 0.22)))
+	adjustedDef := math.Max(0, (math.Min(adjustedDmg+0.1, (rDef-0.10)/(1-0.10))))
+	adjustedSpot := math.Max(0, (math.Min(adjustedDmg+0.1, (rSpot-0.38)/(1-0.38))))
+	adjustedFrag := math.Max(0, (math.Min(adjustedDmg+0.2, (rFrag-0.12)/(1-0.12))))
+
+	rating := math.Round(((980 * adjustedDmg) + (210 * adjustedDmg * adjustedFrag) + (155 * adjustedFrag * adjustedSpot) + (75 * adjustedDef * adjustedFrag) + (145 * math.Min(1.8, adjustedWr))))
+	if math.IsNaN(rating) || math.IsInf(rating, 0) {
+		return 0, false
+	}
+	return rating, true
+}
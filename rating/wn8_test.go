@@ -0,0 +1,45 @@
+package rating
+
+import "testing"
+
+// wn8Averages - Expected values of 0.5 defense points, 1 frag, 1 spot and 1000 damage per battle at 50% winrate
+var wn8Averages = TankAverages{Battles: 1000, DroppedCapturePoints: 500, KillsPerBattle: 1, SpotsPerBattle: 1, DamagePerBattle: 1000, Winrate: 50}
+
+// wn8Tank - 100 battles played at the given ratios to wn8Averages
+func wn8Tank(rDmg, rFrag, rSpot, rDef, rWr float64) VehicleStats {
+	return VehicleStats{
+		Battles:              100,
+		Wins:                 rWr * 50,
+		Frags:                rFrag * 100,
+		DamageDealt:          rDmg * 1000 * 100,
+		Spotted:              rSpot * 100,
+		DroppedCapturePoints: rDef * 0.5 * 100,
+	}
+}
+
+func TestWN8Vehicle(t *testing.T) {
+	tests := []struct {
+		name     string
+		tank     VehicleStats
+		averages TankAverages
+		want     float64
+		wantOK   bool
+	}{
+		{"expected values", wn8Tank(1, 1, 1, 1, 1), wn8Averages, 1565, true},
+		{"double expected values", wn8Tank(2, 2, 2, 2, 2), wn8Averages, 4648, true},
+		{"half expected values", wn8Tank(0.5, 0.5, 0.5, 0.5, 0.8), wn8Averages, 457, true},
+		{"low frags and no defense", wn8Tank(1.5, 0.5, 1, 0, 1.2), wn8Averages, 2069, true},
+		{"no performance", wn8Tank(0, 0, 0, 0, 0), wn8Averages, 0, true},
+		{"no battles", VehicleStats{}, wn8Averages, 0, false},
+		{"no averages", wn8Tank(1, 1, 1, 1, 1), TankAverages{}, 0, false},
+		{"no expected damage", wn8Tank(1, 1, 1, 1, 1), TankAverages{Battles: 1000, DroppedCapturePoints: 500, KillsPerBattle: 1, SpotsPerBattle: 1, Winrate: 50}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := WN8{}.Vehicle(tt.tank, tt.averages)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Vehicle() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,778 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// Buckets
+var (
+	clansBucket        = []byte("clans")
+	playersBucket      = []byte("players")
+	tankAveragesBucket = []byte("tankaverages")
+	snapshotsBucket    = []byte("vehicle_snapshots")
+	historyBucket      = []byte("snapshots")
+	activityBucket     = []byte("daily_activity")
+	eventsBucket       = []byte("member_events")
+	schedulesBucket    = []byte("schedules")
+	sessionsBucket     = []byte("sessions")
+	windowsBucket      = []byte("windows")
+	baselinesBucket    = []byte("window_snapshots")
+	jobsBucket         = []byte("jobs")
+)
+
+// Store - Embedded bbolt implementation of store.Store
+// Records are kept as JSON, keyed by big-endian IDs so iteration is ordered
+type Store struct {
+	db *bbolt.DB
+}
+
+var _ store.Store = (*Store)(nil)
+
+// New - Open or create a bolt database file at path
+func New(path string) (*Store, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("bolt/New: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{clansBucket, playersBucket, tankAveragesBucket, snapshotsBucket, historyBucket, activityBucket, eventsBucket, schedulesBucket, sessionsBucket, windowsBucket, baselinesBucket, jobsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("bolt/New: %v", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close - Close the database file
+func (s *Store) Close(ctx context.Context) error {
+	return s.db.Close()
+}
+
+// itob - Encode an ID as an ordered bolt key
+func itob(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+// recordKey - Records are keyed by realm and WG ID, WG IDs are only unique within a realm
+func recordKey(realm string, id int) []byte {
+	key := append([]byte(store.NormalizeRealm(realm)), ':')
+	return append(key, itob(id)...)
+}
+
+// get - Decode a single record from bucket into target
+func (s *Store) get(bucket []byte, key []byte, target interface{}) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bucket).Get(key)
+		if data == nil {
+			return store.ErrNotFound
+		}
+		return json.Unmarshal(data, target)
+	})
+}
+
+// put - Encode and write a record, failing with ErrNotFound if it does not exist and upsert is false
+func (s *Store) put(bucket []byte, key []byte, record interface{}, upsert bool) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if !upsert && b.Get(key) == nil {
+			return store.ErrNotFound
+		}
+		return b.Put(key, data)
+	})
+}
+
+// each - Call fn with every raw record in bucket, in key order
+func (s *Store) each(bucket []byte, fn func(data []byte) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(_, data []byte) error {
+			return fn(data)
+		})
+	})
+}
+
+// CLANS
+
+// ListClans - Retrieve all clans ordered by realm and ID
+func (s *Store) ListClans(ctx context.Context) ([]store.Clan, error) {
+	var clans []store.Clan
+	err := s.each(clansBucket, func(data []byte) error {
+		var clan store.Clan
+		if err := json.Unmarshal(data, &clan); err != nil {
+			return err
+		}
+		clans = append(clans, clan)
+		return nil
+	})
+	return clans, err
+}
+
+// GetClan - Retrieve the first clan matching filter
+func (s *Store) GetClan(ctx context.Context, filter store.ClanFilter) (store.Clan, error) {
+	if filter.Empty() {
+		return store.Clan{}, fmt.Errorf("bolt/GetClan: %w", store.ErrEmptyFilter)
+	}
+	filter = filter.Normalize()
+	var clanData store.Clan
+	if filter.ID != 0 && filter.Realm != "" {
+		err := s.get(clansBucket, recordKey(filter.Realm, filter.ID), &clanData)
+		if err != nil {
+			return store.Clan{}, err
+		}
+		if !filter.Match(clanData) {
+			return store.Clan{}, store.ErrNotFound
+		}
+		return clanData, nil
+	}
+
+	clans, err := s.ListClans(ctx)
+	if err != nil {
+		return clanData, err
+	}
+	for _, clan := range clans {
+		if filter.Match(clan) {
+			return clan, nil
+		}
+	}
+	return clanData, store.ErrNotFound
+}
+
+// UpdateClan - Replace a clan record, with optional upsert
+func (s *Store) UpdateClan(ctx context.Context, clanData store.Clan, upsert bool) error {
+	clanData = store.NormalizeClan(clanData)
+	clanData.LastUpdate = time.Now().UTC()
+	if err := s.put(clansBucket, recordKey(clanData.Realm, clanData.ID), clanData, upsert); err != nil {
+		return fmt.Errorf("bolt/UpdateClan: %w", err)
+	}
+	return nil
+}
+
+// PLAYERS
+
+// ListPlayers - Retrieve all players ordered by realm and ID
+func (s *Store) ListPlayers(ctx context.Context) ([]store.Player, error) {
+	var players []store.Player
+	err := s.each(playersBucket, func(data []byte) error {
+		var player store.Player
+		if err := json.Unmarshal(data, &player); err != nil {
+			return err
+		}
+		players = append(players, player)
+		return nil
+	})
+	return players, err
+}
+
+// GetPlayer - Retrieve the first player matching filter
+func (s *Store) GetPlayer(ctx context.Context, filter store.PlayerFilter) (store.Player, error) {
+	if filter.Empty() {
+		return store.Player{}, fmt.Errorf("bolt/GetPlayer: %w", store.ErrEmptyFilter)
+	}
+	filter = filter.Normalize()
+	var playerData store.Player
+	if filter.ID != 0 && filter.Realm != "" {
+		err := s.get(playersBucket, recordKey(filter.Realm, filter.ID), &playerData)
+		return playerData, err
+	}
+	players, err := s.ListPlayers(ctx)
+	if err != nil {
+		return playerData, err
+	}
+	for _, player := range players {
+		if filter.Match(player) {
+			return player, nil
+		}
+	}
+	return playerData, store.ErrNotFound
+}
+
+// UpdatePlayer - Replace a player record, with optional upsert
+func (s *Store) UpdatePlayer(ctx context.Context, playerData store.Player, upsert bool) error {
+	playerData = store.NormalizePlayer(playerData)
+	playerData.LastUpdate = time.Now().UTC()
+	if err := s.put(playersBucket, recordKey(playerData.Realm, playerData.ID), playerData, upsert); err != nil {
+		return fmt.Errorf("bolt/UpdatePlayer: %w", err)
+	}
+	return nil
+}
+
+// VEHICLE SNAPSHOTS
+
+// GetVehicleSnapshot - Get the vehicle stats saved for a player at session start
+func (s *Store) GetVehicleSnapshot(ctx context.Context, realm string, playerID int) (store.VehicleSnapshot, error) {
+	var snapshot store.VehicleSnapshot
+	err := s.get(snapshotsBucket, recordKey(realm, playerID), &snapshot)
+	return snapshot, err
+}
+
+// UpdateVehicleSnapshot - Save vehicle stats for a player, replacing any existing snapshot
+func (s *Store) UpdateVehicleSnapshot(ctx context.Context, snapshot store.VehicleSnapshot) error {
+	if err := s.put(snapshotsBucket, recordKey(snapshot.Realm, snapshot.PlayerID), snapshot, true); err != nil {
+		return fmt.Errorf("bolt/UpdateVehicleSnapshot: %w", err)
+	}
+	return nil
+}
+
+// TRACKING WINDOWS
+
+// windowKey - Tracking windows are keyed by clan and name, the trailing zero byte keeps names that prefix each other apart
+func windowKey(realm string, clanID int, name string) []byte {
+	key := append(recordKey(realm, clanID), name...)
+	return append(key, 0)
+}
+
+// ListTrackingWindows - Retrieve all tracking windows of a clan ordered by name
+func (s *Store) ListTrackingWindows(ctx context.Context, realm string, clanID int) ([]store.TrackingWindow, error) {
+	var windows []store.TrackingWindow
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		prefix := recordKey(realm, clanID)
+		c := tx.Bucket(windowsBucket).Cursor()
+		for k, data := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, data = c.Next() {
+			var window store.TrackingWindow
+			if err := json.Unmarshal(data, &window); err != nil {
+				return err
+			}
+			windows = append(windows, window)
+		}
+		return nil
+	})
+	return windows, err
+}
+
+// GetTrackingWindow - Retrieve a tracking window of a clan by name
+func (s *Store) GetTrackingWindow(ctx context.Context, realm string, clanID int, name string) (store.TrackingWindow, error) {
+	var window store.TrackingWindow
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(windowsBucket).Get(windowKey(realm, clanID, name))
+		if data == nil {
+			return store.ErrNotFound
+		}
+		return json.Unmarshal(data, &window)
+	})
+	return window, err
+}
+
+// UpdateTrackingWindow - Save a tracking window, replacing any existing one with the same name
+func (s *Store) UpdateTrackingWindow(ctx context.Context, window store.TrackingWindow) error {
+	data, err := json.Marshal(window)
+	if err != nil {
+		return fmt.Errorf("bolt/UpdateTrackingWindow: %w", err)
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(windowsBucket).Put(windowKey(window.Realm, window.ClanID, window.Name), data)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt/UpdateTrackingWindow: %w", err)
+	}
+	return nil
+}
+
+// DeleteTrackingWindow - Remove a tracking window and all of its baselines
+func (s *Store) DeleteTrackingWindow(ctx context.Context, realm string, clanID int, name string) error {
+	key := windowKey(realm, clanID, name)
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		windows := tx.Bucket(windowsBucket)
+		if windows.Get(key) == nil {
+			return store.ErrNotFound
+		}
+		if err := windows.Delete(key); err != nil {
+			return err
+		}
+		// Collect keys first, deleting while iterating skips records
+		c := tx.Bucket(baselinesBucket).Cursor()
+		var baselines [][]byte
+		for k, _ := c.Seek(key); k != nil && bytes.HasPrefix(k, key); k, _ = c.Next() {
+			baselines = append(baselines, append([]byte(nil), k...))
+		}
+		for _, k := range baselines {
+			if err := tx.Bucket(baselinesBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetWindowSnapshot - Get the vehicle stats saved for a player when a tracking window started
+func (s *Store) GetWindowSnapshot(ctx context.Context, realm string, clanID int, window string, playerID int) (store.WindowSnapshot, error) {
+	var snapshot store.WindowSnapshot
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(baselinesBucket).Get(append(windowKey(realm, clanID, window), itob(playerID)...))
+		if data == nil {
+			return store.ErrNotFound
+		}
+		return json.Unmarshal(data, &snapshot)
+	})
+	return snapshot, err
+}
+
+// UpdateWindowSnapshot - Save a tracking window baseline for a player, replacing any existing one
+func (s *Store) UpdateWindowSnapshot(ctx context.Context, snapshot store.WindowSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("bolt/UpdateWindowSnapshot: %w", err)
+	}
+	key := append(windowKey(snapshot.Realm, snapshot.ClanID, snapshot.Window), itob(snapshot.PlayerID)...)
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(baselinesBucket).Put(key, data)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt/UpdateWindowSnapshot: %w", err)
+	}
+	return nil
+}
+
+// SNAPSHOTS
+
+// historyKey - Snapshots are keyed by timestamp, realm and player ID so a time range is a single cursor scan
+func historyKey(snapshot store.Snapshot) []byte {
+	return append(timeKey(snapshot.Timestamp), recordKey(snapshot.Realm, snapshot.PlayerID)...)
+}
+
+// AddSnapshot - Record player totals at a point in time
+func (s *Store) AddSnapshot(ctx context.Context, snapshot store.Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("bolt/AddSnapshot: %w", err)
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(historyBucket).Put(historyKey(snapshot), data)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt/AddSnapshot: %w", err)
+	}
+	return nil
+}
+
+// GetSnapshots - Get snapshots matching filter, oldest first
+func (s *Store) GetSnapshots(ctx context.Context, filter store.SnapshotFilter) ([]store.Snapshot, error) {
+	filter = filter.Normalize()
+	var snapshots []store.Snapshot
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		k, data := c.First()
+		if !filter.From.IsZero() {
+			k, data = c.Seek(historyKey(store.Snapshot{Timestamp: filter.From}))
+		}
+		for ; k != nil; k, data = c.Next() {
+			var snapshot store.Snapshot
+			if err := json.Unmarshal(data, &snapshot); err != nil {
+				return err
+			}
+			if !filter.To.IsZero() && !snapshot.Timestamp.Before(filter.To) {
+				break
+			}
+			if filter.Match(snapshot) {
+				snapshots = append(snapshots, snapshot)
+			}
+		}
+		return nil
+	})
+	return snapshots, err
+}
+
+// GetLatestSnapshots - Get the most recent snapshot of each player matching filter, ordered by player ID
+// History is scanned backwards from filter.To, and stops early once every player in filter.PlayerIDs was found
+func (s *Store) GetLatestSnapshots(ctx context.Context, filter store.SnapshotFilter) ([]store.Snapshot, error) {
+	filter = filter.Normalize()
+	latest := make(map[int]store.Snapshot)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		k, data := c.Last()
+		if !filter.To.IsZero() {
+			// Seek lands on the first key at or after To, which is not part of the range
+			if k, data = c.Seek(historyKey(store.Snapshot{Timestamp: filter.To})); k != nil {
+				k, data = c.Prev()
+			} else {
+				k, data = c.Last()
+			}
+		}
+		for ; k != nil; k, data = c.Prev() {
+			var snapshot store.Snapshot
+			if err := json.Unmarshal(data, &snapshot); err != nil {
+				return err
+			}
+			if !filter.From.IsZero() && snapshot.Timestamp.Before(filter.From) {
+				break
+			}
+			if _, ok := latest[snapshot.PlayerID]; ok || !filter.Match(snapshot) {
+				continue
+			}
+			latest[snapshot.PlayerID] = snapshot
+			if len(filter.PlayerIDs) > 0 && len(latest) == len(filter.PlayerIDs) {
+				break
+			}
+		}
+		return nil
+	})
+	snapshots := make([]store.Snapshot, 0, len(latest))
+	for _, snapshot := range latest {
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].PlayerID < snapshots[j].PlayerID
+	})
+	return snapshots, err
+}
+
+// DAILY ACTIVITY
+
+// activityKey - Daily rollups are keyed by clan, date and player so a clan date range is a single cursor scan
+func activityKey(day store.DailyActivity) []byte {
+	key := append(recordKey(day.Realm, day.ClanID), day.Date...)
+	return append(key, itob(day.PlayerID)...)
+}
+
+// UpdateDailyActivity - Save daily rollups, replacing existing rows for the same clan, player and date
+func (s *Store) UpdateDailyActivity(ctx context.Context, days []store.DailyActivity) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(activityBucket)
+		for _, day := range days {
+			data, err := json.Marshal(day)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(activityKey(day), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("bolt/UpdateDailyActivity: %w", err)
+	}
+	return nil
+}
+
+// GetDailyActivity - Get daily rollups matching filter, ordered by date
+func (s *Store) GetDailyActivity(ctx context.Context, filter store.DailyActivityFilter) ([]store.DailyActivity, error) {
+	filter = filter.Normalize()
+	var days []store.DailyActivity
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(activityBucket).Cursor()
+		// A clan is only a key prefix when its realm is known, otherwise the whole bucket is scanned
+		var clan, start []byte
+		if filter.ClanID != 0 && filter.Realm != "" {
+			clan = recordKey(filter.Realm, filter.ClanID)
+			start = append(recordKey(filter.Realm, filter.ClanID), filter.From...)
+		}
+		for k, data := c.Seek(start); k != nil; k, data = c.Next() {
+			if !bytes.HasPrefix(k, clan) {
+				break
+			}
+			var day store.DailyActivity
+			if err := json.Unmarshal(data, &day); err != nil {
+				return err
+			}
+			if filter.Match(day) {
+				days = append(days, day)
+			}
+		}
+		return nil
+	})
+	// Without a clan filter rows come back grouped by clan
+	sort.SliceStable(days, func(i, j int) bool {
+		return days[i].Date < days[j].Date
+	})
+	return days, err
+}
+
+// MEMBER EVENTS
+
+// eventKey - Roster changes are keyed by clan, timestamp, player and type so a clan time range is a single cursor scan
+func eventKey(event store.MemberEvent) []byte {
+	key := append(recordKey(event.Realm, event.ClanID), timeKey(event.Timestamp)...)
+	key = append(key, itob(event.PlayerID)...)
+	return append(key, event.Type...)
+}
+
+// timeKey - Encode a timestamp as an ordered bolt key
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// AddMemberEvents - Record clan roster changes
+func (s *Store) AddMemberEvents(ctx context.Context, events []store.MemberEvent) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(eventKey(event), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("bolt/AddMemberEvents: %w", err)
+	}
+	return nil
+}
+
+// GetMemberEvents - Get roster changes matching filter, oldest first
+func (s *Store) GetMemberEvents(ctx context.Context, filter store.MemberEventFilter) ([]store.MemberEvent, error) {
+	filter = filter.Normalize()
+	var events []store.MemberEvent
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		// A clan is only a key prefix when its realm is known, otherwise the whole bucket is scanned
+		var clan, start []byte
+		if filter.ClanID != 0 && filter.Realm != "" {
+			clan = recordKey(filter.Realm, filter.ClanID)
+			start = clan
+			if !filter.From.IsZero() {
+				start = append(recordKey(filter.Realm, filter.ClanID), timeKey(filter.From)...)
+			}
+		}
+		for k, data := c.Seek(start); k != nil; k, data = c.Next() {
+			if !bytes.HasPrefix(k, clan) {
+				break
+			}
+			var event store.MemberEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				return err
+			}
+			if filter.Match(event) {
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+	// Without a clan filter events come back grouped by clan
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events, err
+}
+
+// SCHEDULES
+
+// ListClanSchedules - Retrieve background refresh state of all clans ordered by realm and clan ID
+func (s *Store) ListClanSchedules(ctx context.Context) ([]store.ClanSchedule, error) {
+	var schedules []store.ClanSchedule
+	err := s.each(schedulesBucket, func(data []byte) error {
+		var schedule store.ClanSchedule
+		if err := json.Unmarshal(data, &schedule); err != nil {
+			return err
+		}
+		schedules = append(schedules, schedule)
+		return nil
+	})
+	return schedules, err
+}
+
+// UpdateClanSchedule - Save background refresh state for a clan, replacing any existing one
+func (s *Store) UpdateClanSchedule(ctx context.Context, schedule store.ClanSchedule) error {
+	if err := s.put(schedulesBucket, recordKey(schedule.Realm, schedule.ClanID), schedule, true); err != nil {
+		return fmt.Errorf("bolt/UpdateClanSchedule: %w", err)
+	}
+	return nil
+}
+
+// CLAN SESSIONS
+
+// sessionKey - Archived sessions are keyed by clan and session ID, so a clan's sessions are ordered by end time
+func sessionKey(realm string, clanID int, sessionID int64) []byte {
+	return append(recordKey(realm, clanID), itob(int(sessionID))...)
+}
+
+// AddClanSession - Archive a closed clan session
+func (s *Store) AddClanSession(ctx context.Context, session store.ClanSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("bolt/AddClanSession: %w", err)
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Put(sessionKey(session.Realm, session.ClanID, session.ID), data)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt/AddClanSession: %w", err)
+	}
+	return nil
+}
+
+// ListClanSessions - Get archived sessions matching filter, newest first
+func (s *Store) ListClanSessions(ctx context.Context, filter store.ClanSessionFilter) ([]store.ClanSession, error) {
+	filter = filter.Normalize()
+	var sessions []store.ClanSession
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(sessionsBucket).Cursor()
+		// A clan is only a key prefix when its realm is known, otherwise the whole bucket is scanned
+		var clan []byte
+		if filter.ClanID != 0 && filter.Realm != "" {
+			clan = recordKey(filter.Realm, filter.ClanID)
+		}
+		for k, data := c.Seek(clan); k != nil; k, data = c.Next() {
+			if !bytes.HasPrefix(k, clan) {
+				break
+			}
+			var session store.ClanSession
+			if err := json.Unmarshal(data, &session); err != nil {
+				return err
+			}
+			if filter.Match(session) {
+				sessions = append(sessions, session)
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].EndedAt.After(sessions[j].EndedAt)
+	})
+	return sessions, err
+}
+
+// GetClanSession - Get an archived session of a clan by ID
+func (s *Store) GetClanSession(ctx context.Context, realm string, clanID int, sessionID int64) (store.ClanSession, error) {
+	var session store.ClanSession
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(sessionsBucket).Get(sessionKey(realm, clanID, sessionID))
+		if data == nil {
+			return store.ErrNotFound
+		}
+		return json.Unmarshal(data, &session)
+	})
+	return session, err
+}
+
+// JOBS
+
+// GetJob - Retrieve a background job by ID
+func (s *Store) GetJob(ctx context.Context, id string) (store.Job, error) {
+	var job store.Job
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return store.ErrNotFound
+		}
+		return json.Unmarshal(data, &job)
+	})
+	return job, err
+}
+
+// ListJobs - Retrieve background jobs matching filter, oldest first
+func (s *Store) ListJobs(ctx context.Context, filter store.JobFilter) ([]store.Job, error) {
+	var jobs []store.Job
+	err := s.each(jobsBucket, func(data []byte) error {
+		var job store.Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return err
+		}
+		if filter.Match(job) {
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, err
+}
+
+// UpdateJob - Save a background job, replacing any existing one with the same ID
+func (s *Store) UpdateJob(ctx context.Context, job store.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("bolt/UpdateJob: %w", err)
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt/UpdateJob: %w", err)
+	}
+	return nil
+}
+
+// TANKAVERAGES
+
+// ListTankAverages - Get averages data for all tanks ordered by tank ID
+func (s *Store) ListTankAverages(ctx context.Context) ([]store.TankAverages, error) {
+	var tanks []store.TankAverages
+	err := s.each(tankAveragesBucket, func(data []byte) error {
+		var tank store.TankAverages
+		if err := json.Unmarshal(data, &tank); err != nil {
+			return err
+		}
+		tanks = append(tanks, tank)
+		return nil
+	})
+	return tanks, err
+}
+
+// GetTankAvg - Get averages data for a tank matching filter
+func (s *Store) GetTankAvg(ctx context.Context, filter store.TankFilter) (store.TankAverages, error) {
+	if filter.Empty() {
+		return store.TankAverages{}, fmt.Errorf("bolt/GetTankAvg: %w", store.ErrEmptyFilter)
+	}
+	var tankData store.TankAverages
+	err := s.get(tankAveragesBucket, itob(filter.TankID), &tankData)
+	return tankData, err
+}
+
+// Import - Write clans, players, tank averages and snapshots as-is in a single transaction
+// Existing records with the same IDs are replaced and LastUpdate is preserved
+func (s *Store) Import(ctx context.Context, clans []store.Clan, players []store.Player, tanks []store.TankAverages, snapshots []store.Snapshot) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		for _, clan := range clans {
+			if err := putJSON(tx.Bucket(clansBucket), recordKey(clan.Realm, clan.ID), clan); err != nil {
+				return err
+			}
+		}
+		for _, player := range players {
+			if err := putJSON(tx.Bucket(playersBucket), recordKey(player.Realm, player.ID), player); err != nil {
+				return err
+			}
+		}
+		for _, tank := range tanks {
+			if err := putJSON(tx.Bucket(tankAveragesBucket), itob(tank.TankID), tank); err != nil {
+				return err
+			}
+		}
+		for _, snapshot := range snapshots {
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket(historyBucket).Put(historyKey(snapshot), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// putJSON - Encode record and write it to bucket
+func putJSON(b *bbolt.Bucket, key []byte, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
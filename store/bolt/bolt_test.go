@@ -0,0 +1,19 @@
+package bolt
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cufee/am-clanactivity/store"
+	"github.com/cufee/am-clanactivity/store/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		db, err := New(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
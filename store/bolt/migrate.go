@@ -0,0 +1,226 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// MigrateRealmKeys - Rewrite records keyed by WG ID alone to realm and ID keys, returning the number of records migrated per bucket
+// Clans without a realm get defaultRealm, other records take the realm of their clan or player and fall back to defaultRealm
+// Migrated records are left alone so the migration can be run again
+func (s *Store) MigrateRealmKeys(defaultRealm string) (map[string]int, error) {
+	defaultRealm = strings.ToUpper(defaultRealm)
+	migrated := make(map[string]int)
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		clanBucket := tx.Bucket(clansBucket)
+		count, err := migrateBucket(clanBucket, bareID, func(data []byte) ([]byte, []byte, error) {
+			var clan store.Clan
+			if err := json.Unmarshal(data, &clan); err != nil {
+				return nil, nil, err
+			}
+			if clan.Realm == "" {
+				clan.Realm = defaultRealm
+			}
+			clan.Realm = strings.ToUpper(clan.Realm)
+			return marshalRecord(recordKey(clan.Realm, clan.ID), clan)
+		})
+		migrated[string(clansBucket)] = count
+		if err != nil {
+			return fmt.Errorf("clans: %w", err)
+		}
+
+		// Players are in the realm of their clan
+		clanRealms := make(map[int]string)
+		err = clanBucket.ForEach(func(_, data []byte) error {
+			var clan store.Clan
+			if err := json.Unmarshal(data, &clan); err != nil {
+				return err
+			}
+			clanRealms[clan.ID] = clan.Realm
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		clanRealm := func(clanID int) string {
+			if realm := clanRealms[clanID]; realm != "" {
+				return realm
+			}
+			return defaultRealm
+		}
+		playerBucket := tx.Bucket(playersBucket)
+		count, err = migrateBucket(playerBucket, bareID, func(data []byte) ([]byte, []byte, error) {
+			var player store.Player
+			if err := json.Unmarshal(data, &player); err != nil {
+				return nil, nil, err
+			}
+			if player.Realm == "" {
+				player.Realm = clanRealm(player.ClanID)
+			}
+			return marshalRecord(recordKey(player.Realm, player.ID), player)
+		})
+		migrated[string(playersBucket)] = count
+		if err != nil {
+			return fmt.Errorf("players: %w", err)
+		}
+
+		playerRealms := make(map[int]string)
+		err = playerBucket.ForEach(func(_, data []byte) error {
+			var player store.Player
+			if err := json.Unmarshal(data, &player); err != nil {
+				return err
+			}
+			playerRealms[player.ID] = player.Realm
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		playerRealm := func(playerID int) string {
+			if realm := playerRealms[playerID]; realm != "" {
+				return realm
+			}
+			return defaultRealm
+		}
+
+		buckets := []struct {
+			name    []byte
+			convert func(data []byte) ([]byte, []byte, error)
+		}{
+			{snapshotsBucket, func(data []byte) ([]byte, []byte, error) {
+				var snapshot store.VehicleSnapshot
+				if err := json.Unmarshal(data, &snapshot); err != nil {
+					return nil, nil, err
+				}
+				snapshot.Realm = playerRealm(snapshot.PlayerID)
+				return marshalRecord(recordKey(snapshot.Realm, snapshot.PlayerID), snapshot)
+			}},
+			{historyBucket, func(data []byte) ([]byte, []byte, error) {
+				var snapshot store.Snapshot
+				if err := json.Unmarshal(data, &snapshot); err != nil {
+					return nil, nil, err
+				}
+				// Snapshots of clanless players fall back to the player realm
+				snapshot.Realm = playerRealm(snapshot.PlayerID)
+				if realm, ok := clanRealms[snapshot.ClanID]; ok && snapshot.ClanID != 0 {
+					snapshot.Realm = realm
+				}
+				return marshalRecord(historyKey(snapshot), snapshot)
+			}},
+			{activityBucket, func(data []byte) ([]byte, []byte, error) {
+				var day store.DailyActivity
+				if err := json.Unmarshal(data, &day); err != nil {
+					return nil, nil, err
+				}
+				day.Realm = clanRealm(day.ClanID)
+				return marshalRecord(activityKey(day), day)
+			}},
+			{eventsBucket, func(data []byte) ([]byte, []byte, error) {
+				var event store.MemberEvent
+				if err := json.Unmarshal(data, &event); err != nil {
+					return nil, nil, err
+				}
+				event.Realm = clanRealm(event.ClanID)
+				return marshalRecord(eventKey(event), event)
+			}},
+			{schedulesBucket, func(data []byte) ([]byte, []byte, error) {
+				var schedule store.ClanSchedule
+				if err := json.Unmarshal(data, &schedule); err != nil {
+					return nil, nil, err
+				}
+				schedule.Realm = clanRealm(schedule.ClanID)
+				return marshalRecord(recordKey(schedule.Realm, schedule.ClanID), schedule)
+			}},
+			{sessionsBucket, func(data []byte) ([]byte, []byte, error) {
+				var session store.ClanSession
+				if err := json.Unmarshal(data, &session); err != nil {
+					return nil, nil, err
+				}
+				session.Realm = clanRealm(session.ClanID)
+				return marshalRecord(sessionKey(session.Realm, session.ClanID, session.ID), session)
+			}},
+			{windowsBucket, func(data []byte) ([]byte, []byte, error) {
+				var window store.TrackingWindow
+				if err := json.Unmarshal(data, &window); err != nil {
+					return nil, nil, err
+				}
+				window.Realm = clanRealm(window.ClanID)
+				return marshalRecord(windowKey(window.Realm, window.ClanID, window.Name), window)
+			}},
+			{baselinesBucket, func(data []byte) ([]byte, []byte, error) {
+				var snapshot store.WindowSnapshot
+				if err := json.Unmarshal(data, &snapshot); err != nil {
+					return nil, nil, err
+				}
+				snapshot.Realm = clanRealm(snapshot.ClanID)
+				return marshalRecord(append(windowKey(snapshot.Realm, snapshot.ClanID, snapshot.Window), itob(snapshot.PlayerID)...), snapshot)
+			}},
+		}
+		for _, bucket := range buckets {
+			count, err := migrateBucket(tx.Bucket(bucket.name), withoutRealm, bucket.convert)
+			migrated[string(bucket.name)] = count
+			if err != nil {
+				return fmt.Errorf("%s: %w", bucket.name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt/MigrateRealmKeys: %w", err)
+	}
+	return migrated, nil
+}
+
+// bareID - Clans and players were keyed by their 8 byte ID alone
+func bareID(key, _ []byte) bool {
+	return len(key) == 8
+}
+
+// withoutRealm - Other records were keyed by clan or player ID and stored without a realm
+func withoutRealm(_, data []byte) bool {
+	var record struct {
+		Realm string `json:"realm"`
+	}
+	return json.Unmarshal(data, &record) == nil && record.Realm == ""
+}
+
+// migrateBucket - Replace every legacy record with the key and data returned by convert, returning the number of records replaced
+func migrateBucket(b *bbolt.Bucket, legacy func(key, data []byte) bool, convert func(data []byte) ([]byte, []byte, error)) (int, error) {
+	// Keys can not be changed while iterating, collect the old records first
+	var keys [][]byte
+	err := b.ForEach(func(key, data []byte) error {
+		if legacy(key, data) {
+			keys = append(keys, append([]byte(nil), key...))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, key := range keys {
+		newKey, data, err := convert(b.Get(key))
+		if err != nil {
+			return i, err
+		}
+		if err := b.Delete(key); err != nil {
+			return i, err
+		}
+		if err := b.Put(newKey, data); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
+
+// marshalRecord - Encode record for the key it is stored under
+func marshalRecord(key []byte, record interface{}) ([]byte, []byte, error) {
+	data, err := json.Marshal(record)
+	return key, data, err
+}
@@ -0,0 +1,152 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// putLegacy - Save records the way they were stored before realms, keyed by ID alone and without a realm
+func putLegacy(t *testing.T, db *Store, bucket []byte, records map[int]interface{}) {
+	err := db.db.Update(func(tx *bbolt.Tx) error {
+		for id, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket(bucket).Put(itob(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dump - Every key and value in the migrated buckets
+func dump(t *testing.T, db *Store) map[string][]byte {
+	records := make(map[string][]byte)
+	err := db.db.View(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{clansBucket, playersBucket, snapshotsBucket, historyBucket, activityBucket, eventsBucket, schedulesBucket, sessionsBucket, windowsBucket, baselinesBucket} {
+			err := tx.Bucket(name).ForEach(func(key, data []byte) error {
+				records[string(name)+"/"+string(key)] = append([]byte(nil), data...)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestMigrateRealmKeys(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close(ctx)
+
+	base := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Clan 1 has no realm and gets the default one, clan 2 was saved with a lowercase realm
+	putLegacy(t, db, clansBucket, map[int]interface{}{
+		1: store.Clan{ID: 1, ClanTag: "ONE", MembersIds: []int{10}},
+		2: store.Clan{ID: 2, ClanTag: "TWO", Realm: "eu", MembersIds: []int{20}},
+	})
+	putLegacy(t, db, playersBucket, map[int]interface{}{
+		10: store.Player{ID: 10, ClanID: 1},
+		20: store.Player{ID: 20, ClanID: 2},
+	})
+	putLegacy(t, db, snapshotsBucket, map[int]interface{}{20: store.VehicleSnapshot{PlayerID: 20, Vehicles: []wgapi.VehicleStats{{TankID: 1}}}})
+	putLegacy(t, db, historyBucket, map[int]interface{}{1: store.Snapshot{PlayerID: 20, ClanID: 2, Timestamp: base, Battles: 5}})
+	putLegacy(t, db, activityBucket, map[int]interface{}{1: store.DailyActivity{ClanID: 1, Date: "2021-03-01", Battles: 3}})
+	putLegacy(t, db, eventsBucket, map[int]interface{}{1: store.MemberEvent{ClanID: 2, PlayerID: 20, Type: store.MemberJoined, Timestamp: base}})
+	putLegacy(t, db, schedulesBucket, map[int]interface{}{2: store.ClanSchedule{ClanID: 2, NextRun: base}})
+	putLegacy(t, db, sessionsBucket, map[int]interface{}{1: store.ClanSession{ID: 100, ClanID: 1, EndedAt: base}})
+	putLegacy(t, db, windowsBucket, map[int]interface{}{1: store.TrackingWindow{ClanID: 1, Name: "week", CreatedAt: base}})
+	putLegacy(t, db, baselinesBucket, map[int]interface{}{1: store.WindowSnapshot{ClanID: 1, Window: "week", PlayerID: 10}})
+
+	migrated, err := db.MigrateRealmKeys("na")
+	if err != nil {
+		t.Fatalf("MigrateRealmKeys() error = %v", err)
+	}
+	for bucket, want := range map[string]int{"clans": 2, "players": 2, "vehicle_snapshots": 1, "snapshots": 1, "daily_activity": 1, "member_events": 1, "schedules": 1, "sessions": 1, "windows": 1, "window_snapshots": 1} {
+		if migrated[bucket] != want {
+			t.Errorf("MigrateRealmKeys() migrated %d %s, want %d", migrated[bucket], bucket, want)
+		}
+	}
+
+	// Records are found under the realm of their clan or player
+	if clan, err := db.GetClan(ctx, store.ClanFilter{ID: 1, Realm: "NA"}); err != nil || clan.ClanTag != "ONE" {
+		t.Errorf("GetClan on NA = %+v, %v, want clan ONE", clan, err)
+	}
+	if clan, err := db.GetClan(ctx, store.ClanFilter{ID: 2, Realm: "EU"}); err != nil || clan.ClanTag != "TWO" || clan.Realm != "EU" {
+		t.Errorf("GetClan on EU = %+v, %v, want clan TWO", clan, err)
+	}
+	if player, err := db.GetPlayer(ctx, store.PlayerFilter{ID: 10, Realm: "NA"}); err != nil || player.Realm != "NA" {
+		t.Errorf("GetPlayer on NA = %+v, %v", player, err)
+	}
+	if player, err := db.GetPlayer(ctx, store.PlayerFilter{ID: 20, Realm: "EU"}); err != nil || player.Realm != "EU" {
+		t.Errorf("GetPlayer on EU = %+v, %v", player, err)
+	}
+	if snapshot, err := db.GetVehicleSnapshot(ctx, "EU", 20); err != nil || len(snapshot.Vehicles) != 1 {
+		t.Errorf("GetVehicleSnapshot on EU = %+v, %v", snapshot, err)
+	}
+	if snapshots, err := db.GetSnapshots(ctx, store.SnapshotFilter{Realm: "EU", PlayerID: 20}); err != nil || len(snapshots) != 1 {
+		t.Errorf("GetSnapshots on EU = %+v, %v, want one snapshot", snapshots, err)
+	}
+	if rows, err := db.GetDailyActivity(ctx, store.DailyActivityFilter{Realm: "NA", ClanID: 1}); err != nil || len(rows) != 1 {
+		t.Errorf("GetDailyActivity on NA = %+v, %v, want one row", rows, err)
+	}
+	if events, err := db.GetMemberEvents(ctx, store.MemberEventFilter{Realm: "EU", ClanID: 2}); err != nil || len(events) != 1 {
+		t.Errorf("GetMemberEvents on EU = %+v, %v, want one event", events, err)
+	}
+	if schedules, err := db.ListClanSchedules(ctx); err != nil || len(schedules) != 1 || schedules[0].Realm != "EU" {
+		t.Errorf("ListClanSchedules() = %+v, %v, want the EU schedule", schedules, err)
+	}
+	if _, err := db.GetClanSession(ctx, "NA", 1, 100); err != nil {
+		t.Errorf("GetClanSession on NA = %v", err)
+	}
+	if _, err := db.GetTrackingWindow(ctx, "NA", 1, "week"); err != nil {
+		t.Errorf("GetTrackingWindow on NA = %v", err)
+	}
+	if _, err := db.GetWindowSnapshot(ctx, "NA", 1, "week", 10); err != nil {
+		t.Errorf("GetWindowSnapshot on NA = %v", err)
+	}
+
+	// A second run finds nothing left to migrate and changes nothing
+	before := dump(t, db)
+	migrated, err = db.MigrateRealmKeys("na")
+	if err != nil {
+		t.Fatalf("MigrateRealmKeys() again error = %v", err)
+	}
+	for bucket, count := range migrated {
+		if count != 0 {
+			t.Errorf("MigrateRealmKeys() again migrated %d %s, want 0", count, bucket)
+		}
+	}
+	after := dump(t, db)
+	if len(after) != len(before) {
+		t.Errorf("MigrateRealmKeys() again left %d records, want %d", len(after), len(before))
+	}
+	for key, data := range before {
+		if !bytes.Equal(after[key], data) {
+			t.Errorf("MigrateRealmKeys() again changed %s from %s to %s", key, data, after[key])
+		}
+	}
+}
@@ -0,0 +1,629 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// Store - In-memory implementation of store.Store, safe for concurrent use
+type Store struct {
+	mu           sync.RWMutex
+	clans        map[string]store.Clan
+	players      map[string]store.Player
+	tankAverages map[int]store.TankAverages
+	snapshots    map[string]store.VehicleSnapshot
+	history      []store.Snapshot
+	activity     map[activityKey]store.DailyActivity
+	events       []store.MemberEvent
+	schedules    map[string]store.ClanSchedule
+	sessions     []store.ClanSession
+	windows      map[windowKey]store.TrackingWindow
+	baselines    map[baselineKey]store.WindowSnapshot
+	jobs         map[string]store.Job
+}
+
+// windowKey - Tracking windows are unique per realm, clan and name
+type windowKey struct {
+	clan string
+	name string
+}
+
+// baselineKey - Tracking window baselines are unique per window and player
+type baselineKey struct {
+	windowKey
+	playerID int
+}
+
+// activityKey - Daily rollups are unique per realm, clan, player and date
+type activityKey struct {
+	clan     string
+	playerID int
+	date     string
+}
+
+var _ store.Store = (*Store)(nil)
+
+// New - Create an empty in-memory store
+func New() *Store {
+	return &Store{
+		clans:        make(map[string]store.Clan),
+		players:      make(map[string]store.Player),
+		tankAverages: make(map[int]store.TankAverages),
+		snapshots:    make(map[string]store.VehicleSnapshot),
+		activity:     make(map[activityKey]store.DailyActivity),
+		schedules:    make(map[string]store.ClanSchedule),
+		windows:      make(map[windowKey]store.TrackingWindow),
+		baselines:    make(map[baselineKey]store.WindowSnapshot),
+		jobs:         make(map[string]store.Job),
+	}
+}
+
+// Close - Nothing to release
+func (s *Store) Close(ctx context.Context) error {
+	return nil
+}
+
+// CLANS
+
+// ListClans - Retrieve all clans ordered by ID and realm
+func (s *Store) ListClans(ctx context.Context) ([]store.Clan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clans := make([]store.Clan, 0, len(s.clans))
+	for _, clan := range s.sortedClans() {
+		clans = append(clans, copyClan(clan))
+	}
+	return clans, nil
+}
+
+// sortedClans - Stored clans ordered by ID and realm, callers must hold the lock
+func (s *Store) sortedClans() []store.Clan {
+	clans := make([]store.Clan, 0, len(s.clans))
+	for _, clan := range s.clans {
+		clans = append(clans, clan)
+	}
+	sort.Slice(clans, func(i, j int) bool {
+		if clans[i].ID != clans[j].ID {
+			return clans[i].ID < clans[j].ID
+		}
+		return clans[i].Realm < clans[j].Realm
+	})
+	return clans
+}
+
+// GetClan - Retrieve the first clan matching filter
+func (s *Store) GetClan(ctx context.Context, filter store.ClanFilter) (store.Clan, error) {
+	if filter.Empty() {
+		return store.Clan{}, fmt.Errorf("memory/GetClan: %w", store.ErrEmptyFilter)
+	}
+	filter = filter.Normalize()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, clan := range s.sortedClans() {
+		if filter.Match(clan) {
+			return copyClan(clan), nil
+		}
+	}
+	return store.Clan{}, store.ErrNotFound
+}
+
+// UpdateClan - Replace a clan record, with optional upsert
+func (s *Store) UpdateClan(ctx context.Context, clanData store.Clan, upsert bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clanData = store.NormalizeClan(clanData)
+	key := store.RecordKey(clanData.Realm, clanData.ID)
+	if _, ok := s.clans[key]; !ok && !upsert {
+		return fmt.Errorf("memory/UpdateClan: %w", store.ErrNotFound)
+	}
+	clanData.LastUpdate = time.Now().UTC()
+	s.clans[key] = copyClan(clanData)
+	return nil
+}
+
+// copyClan - Copy a clan so callers can not modify stored slices and pointers
+func copyClan(clan store.Clan) store.Clan {
+	clan.MembersIds = append([]int(nil), clan.MembersIds...)
+	if clan.ResetSchedule != nil {
+		schedule := *clan.ResetSchedule
+		clan.ResetSchedule = &schedule
+	}
+	return clan
+}
+
+// PLAYERS
+
+// ListPlayers - Retrieve all players ordered by ID and realm
+func (s *Store) ListPlayers(ctx context.Context) ([]store.Player, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	players := s.sortedPlayers()
+	for i := range players {
+		players[i] = copyPlayer(players[i])
+	}
+	return players, nil
+}
+
+// sortedPlayers - Stored players ordered by ID and realm, callers must hold the lock
+func (s *Store) sortedPlayers() []store.Player {
+	players := make([]store.Player, 0, len(s.players))
+	for _, player := range s.players {
+		players = append(players, player)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].ID != players[j].ID {
+			return players[i].ID < players[j].ID
+		}
+		return players[i].Realm < players[j].Realm
+	})
+	return players
+}
+
+// GetPlayer - Retrieve the first player matching filter
+func (s *Store) GetPlayer(ctx context.Context, filter store.PlayerFilter) (store.Player, error) {
+	if filter.Empty() {
+		return store.Player{}, fmt.Errorf("memory/GetPlayer: %w", store.ErrEmptyFilter)
+	}
+	filter = filter.Normalize()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if filter.ID != 0 && filter.Realm != "" {
+		player, ok := s.players[store.RecordKey(filter.Realm, filter.ID)]
+		if !ok {
+			return store.Player{}, store.ErrNotFound
+		}
+		return copyPlayer(player), nil
+	}
+	for _, player := range s.sortedPlayers() {
+		if filter.Match(player) {
+			return copyPlayer(player), nil
+		}
+	}
+	return store.Player{}, store.ErrNotFound
+}
+
+// UpdatePlayer - Replace a player record, with optional upsert
+func (s *Store) UpdatePlayer(ctx context.Context, playerData store.Player, upsert bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playerData = store.NormalizePlayer(playerData)
+	key := store.RecordKey(playerData.Realm, playerData.ID)
+	if _, ok := s.players[key]; !ok && !upsert {
+		return fmt.Errorf("memory/UpdatePlayer: %w", store.ErrNotFound)
+	}
+	playerData.LastUpdate = time.Now().UTC()
+	s.players[key] = copyPlayer(playerData)
+	return nil
+}
+
+// copyPlayer - Copy a player so callers can not modify stored slices and pointers
+func copyPlayer(player store.Player) store.Player {
+	if player.LeftAt != nil {
+		leftAt := *player.LeftAt
+		player.LeftAt = &leftAt
+	}
+	if player.SessionStats != nil {
+		stats := *player.SessionStats
+		player.SessionStats = &stats
+	}
+	if player.CareerStats != nil {
+		stats := *player.CareerStats
+		player.CareerStats = &stats
+	}
+	player.SessionVehicles = append([]store.SessionVehicle(nil), player.SessionVehicles...)
+	return player
+}
+
+// VEHICLE SNAPSHOTS
+
+// GetVehicleSnapshot - Get the vehicle stats saved for a player at session start
+func (s *Store) GetVehicleSnapshot(ctx context.Context, realm string, playerID int) (store.VehicleSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot, ok := s.snapshots[store.RecordKey(realm, playerID)]
+	if !ok {
+		return store.VehicleSnapshot{}, store.ErrNotFound
+	}
+	snapshot.Vehicles = append([]wgapi.VehicleStats(nil), snapshot.Vehicles...)
+	return snapshot, nil
+}
+
+// UpdateVehicleSnapshot - Save vehicle stats for a player, replacing any existing snapshot
+func (s *Store) UpdateVehicleSnapshot(ctx context.Context, snapshot store.VehicleSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot.Vehicles = append([]wgapi.VehicleStats(nil), snapshot.Vehicles...)
+	s.snapshots[store.RecordKey(snapshot.Realm, snapshot.PlayerID)] = snapshot
+	return nil
+}
+
+// TRACKING WINDOWS
+
+// ListTrackingWindows - Retrieve all tracking windows of a clan ordered by name
+func (s *Store) ListTrackingWindows(ctx context.Context, realm string, clanID int) ([]store.TrackingWindow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clan := store.RecordKey(realm, clanID)
+	var windows []store.TrackingWindow
+	for key, window := range s.windows {
+		if key.clan == clan {
+			windows = append(windows, window)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].Name < windows[j].Name
+	})
+	return windows, nil
+}
+
+// GetTrackingWindow - Retrieve a tracking window of a clan by name
+func (s *Store) GetTrackingWindow(ctx context.Context, realm string, clanID int, name string) (store.TrackingWindow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	window, ok := s.windows[windowKey{store.RecordKey(realm, clanID), name}]
+	if !ok {
+		return store.TrackingWindow{}, store.ErrNotFound
+	}
+	return window, nil
+}
+
+// UpdateTrackingWindow - Save a tracking window, replacing any existing one with the same name
+func (s *Store) UpdateTrackingWindow(ctx context.Context, window store.TrackingWindow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.windows[windowKey{store.RecordKey(window.Realm, window.ClanID), window.Name}] = window
+	return nil
+}
+
+// DeleteTrackingWindow - Remove a tracking window and all of its baselines
+func (s *Store) DeleteTrackingWindow(ctx context.Context, realm string, clanID int, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := windowKey{store.RecordKey(realm, clanID), name}
+	if _, ok := s.windows[key]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.windows, key)
+	for baseline := range s.baselines {
+		if baseline.windowKey == key {
+			delete(s.baselines, baseline)
+		}
+	}
+	return nil
+}
+
+// GetWindowSnapshot - Get the vehicle stats saved for a player when a tracking window started
+func (s *Store) GetWindowSnapshot(ctx context.Context, realm string, clanID int, window string, playerID int) (store.WindowSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot, ok := s.baselines[baselineKey{windowKey{store.RecordKey(realm, clanID), window}, playerID}]
+	if !ok {
+		return store.WindowSnapshot{}, store.ErrNotFound
+	}
+	snapshot.Vehicles = append([]wgapi.VehicleStats(nil), snapshot.Vehicles...)
+	return snapshot, nil
+}
+
+// UpdateWindowSnapshot - Save a tracking window baseline for a player, replacing any existing one
+func (s *Store) UpdateWindowSnapshot(ctx context.Context, snapshot store.WindowSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot.Vehicles = append([]wgapi.VehicleStats(nil), snapshot.Vehicles...)
+	s.baselines[baselineKey{windowKey{store.RecordKey(snapshot.Realm, snapshot.ClanID), snapshot.Window}, snapshot.PlayerID}] = snapshot
+	return nil
+}
+
+// SNAPSHOTS
+
+// AddSnapshot - Record player totals at a point in time
+func (s *Store) AddSnapshot(ctx context.Context, snapshot store.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history = append(s.history, snapshot)
+	return nil
+}
+
+// GetSnapshots - Get snapshots matching filter, oldest first
+func (s *Store) GetSnapshots(ctx context.Context, filter store.SnapshotFilter) ([]store.Snapshot, error) {
+	filter = filter.Normalize()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var snapshots []store.Snapshot
+	for _, snapshot := range s.history {
+		if filter.Match(snapshot) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp.Before(snapshots[j].Timestamp)
+	})
+	return snapshots, nil
+}
+
+// GetLatestSnapshots - Get the most recent snapshot of each player matching filter, ordered by player ID
+func (s *Store) GetLatestSnapshots(ctx context.Context, filter store.SnapshotFilter) ([]store.Snapshot, error) {
+	filter = filter.Normalize()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latest := make(map[int]store.Snapshot)
+	for _, snapshot := range s.history {
+		if !filter.Match(snapshot) {
+			continue
+		}
+		if prev, ok := latest[snapshot.PlayerID]; !ok || snapshot.Timestamp.After(prev.Timestamp) {
+			latest[snapshot.PlayerID] = snapshot
+		}
+	}
+	snapshots := make([]store.Snapshot, 0, len(latest))
+	for _, snapshot := range latest {
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].PlayerID < snapshots[j].PlayerID
+	})
+	return snapshots, nil
+}
+
+// DAILY ACTIVITY
+
+// UpdateDailyActivity - Save daily rollups, replacing existing rows for the same realm, clan, player and date
+func (s *Store) UpdateDailyActivity(ctx context.Context, days []store.DailyActivity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, day := range days {
+		s.activity[activityKey{store.RecordKey(day.Realm, day.ClanID), day.PlayerID, day.Date}] = day
+	}
+	return nil
+}
+
+// GetDailyActivity - Get daily rollups matching filter, ordered by date
+func (s *Store) GetDailyActivity(ctx context.Context, filter store.DailyActivityFilter) ([]store.DailyActivity, error) {
+	filter = filter.Normalize()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var days []store.DailyActivity
+	for _, day := range s.activity {
+		if filter.Match(day) {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].Date != days[j].Date {
+			return days[i].Date < days[j].Date
+		}
+		return days[i].PlayerID < days[j].PlayerID
+	})
+	return days, nil
+}
+
+// MEMBER EVENTS
+
+// AddMemberEvents - Record clan roster changes
+func (s *Store) AddMemberEvents(ctx context.Context, events []store.MemberEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, events...)
+	return nil
+}
+
+// GetMemberEvents - Get roster changes matching filter, oldest first
+func (s *Store) GetMemberEvents(ctx context.Context, filter store.MemberEventFilter) ([]store.MemberEvent, error) {
+	filter = filter.Normalize()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []store.MemberEvent
+	for _, event := range s.events {
+		if filter.Match(event) {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events, nil
+}
+
+// SCHEDULES
+
+// ListClanSchedules - Retrieve background refresh state of all clans ordered by clan ID and realm
+func (s *Store) ListClanSchedules(ctx context.Context) ([]store.ClanSchedule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedules := make([]store.ClanSchedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		if schedules[i].ClanID != schedules[j].ClanID {
+			return schedules[i].ClanID < schedules[j].ClanID
+		}
+		return schedules[i].Realm < schedules[j].Realm
+	})
+	return schedules, nil
+}
+
+// UpdateClanSchedule - Save background refresh state for a clan, replacing any existing one
+func (s *Store) UpdateClanSchedule(ctx context.Context, schedule store.ClanSchedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schedules[store.RecordKey(schedule.Realm, schedule.ClanID)] = schedule
+	return nil
+}
+
+// CLAN SESSIONS
+
+// AddClanSession - Archive a closed clan session
+func (s *Store) AddClanSession(ctx context.Context, session store.ClanSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.Players = append([]store.SessionPlayer(nil), session.Players...)
+	s.sessions = append(s.sessions, session)
+	return nil
+}
+
+// ListClanSessions - Get archived sessions matching filter, newest first
+func (s *Store) ListClanSessions(ctx context.Context, filter store.ClanSessionFilter) ([]store.ClanSession, error) {
+	filter = filter.Normalize()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []store.ClanSession
+	for _, session := range s.sessions {
+		if filter.Match(session) {
+			session.Players = append([]store.SessionPlayer(nil), session.Players...)
+			sessions = append(sessions, session)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].EndedAt.After(sessions[j].EndedAt)
+	})
+	return sessions, nil
+}
+
+// GetClanSession - Get an archived session of a clan by ID
+func (s *Store) GetClanSession(ctx context.Context, realm string, clanID int, sessionID int64) (store.ClanSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	realm = store.NormalizeRealm(realm)
+	for _, session := range s.sessions {
+		if session.Realm == realm && session.ClanID == clanID && session.ID == sessionID {
+			session.Players = append([]store.SessionPlayer(nil), session.Players...)
+			return session, nil
+		}
+	}
+	return store.ClanSession{}, store.ErrNotFound
+}
+
+// JOBS
+
+// GetJob - Retrieve a background job by ID
+func (s *Store) GetJob(ctx context.Context, id string) (store.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return store.Job{}, store.ErrNotFound
+	}
+	return copyJob(job), nil
+}
+
+// ListJobs - Retrieve background jobs matching filter, oldest first
+func (s *Store) ListJobs(ctx context.Context, filter store.JobFilter) ([]store.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var jobs []store.Job
+	for _, job := range s.jobs {
+		if filter.Match(job) {
+			jobs = append(jobs, copyJob(job))
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// UpdateJob - Save a background job, replacing any existing one with the same ID
+func (s *Store) UpdateJob(ctx context.Context, job store.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = copyJob(job)
+	return nil
+}
+
+// copyJob - Copy a job so callers can not modify stored slices
+func copyJob(job store.Job) store.Job {
+	job.Errors = append([]store.JobError(nil), job.Errors...)
+	job.Result = append([]byte(nil), job.Result...)
+	return job
+}
+
+// TANKAVERAGES
+
+// ListTankAverages - Get averages data for all tanks ordered by tank ID
+func (s *Store) ListTankAverages(ctx context.Context) ([]store.TankAverages, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]int, 0, len(s.tankAverages))
+	for id := range s.tankAverages {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	tanks := make([]store.TankAverages, 0, len(ids))
+	for _, id := range ids {
+		tanks = append(tanks, s.tankAverages[id])
+	}
+	return tanks, nil
+}
+
+// GetTankAvg - Get averages data for a tank matching filter
+func (s *Store) GetTankAvg(ctx context.Context, filter store.TankFilter) (store.TankAverages, error) {
+	if filter.Empty() {
+		return store.TankAverages{}, fmt.Errorf("memory/GetTankAvg: %w", store.ErrEmptyFilter)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tank, ok := s.tankAverages[filter.TankID]
+	if !ok {
+		return store.TankAverages{}, store.ErrNotFound
+	}
+	return tank, nil
+}
+
+// PutTankAvg - Add or replace averages data for a tank
+func (s *Store) PutTankAvg(tankData store.TankAverages) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tankAverages[tankData.TankID] = tankData
+}
+
+// LoadTankAverages - Read a JSON array of tank averages and add them to the store
+func (s *Store) LoadTankAverages(r io.Reader) (int, error) {
+	var tanks []store.TankAverages
+	if err := json.NewDecoder(r).Decode(&tanks); err != nil {
+		return 0, fmt.Errorf("memory/LoadTankAverages: %v", err)
+	}
+	for _, tank := range tanks {
+		s.PutTankAvg(tank)
+	}
+	return len(tanks), nil
+}
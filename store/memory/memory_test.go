@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/cufee/am-clanactivity/store"
+	"github.com/cufee/am-clanactivity/store/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return New()
+	})
+}
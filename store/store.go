@@ -0,0 +1,614 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+)
+
+// ErrNotFound - Returned when no record matches a filter
+var ErrNotFound = errors.New("record not found")
+
+// ErrEmptyFilter - Returned by single record lookups when the filter does not identify a record
+var ErrEmptyFilter = errors.New("filter does not identify a record")
+
+// RecordKey - Storage key of a clan or player, WG IDs are only unique within a realm
+func RecordKey(realm string, id int) string {
+	return NormalizeRealm(realm) + ":" + strconv.Itoa(id)
+}
+
+// NormalizeRealm - Realm name records are stored and looked up under, uppercase with AS stored as ASIA
+// Names that are not a known realm are only uppercased
+func NormalizeRealm(realm string) string {
+	if parsed, err := wgapi.ParseRealm(realm); err == nil {
+		return string(parsed)
+	}
+	return strings.ToUpper(realm)
+}
+
+// Store - Storage backend for clans, players and tank averages
+type Store interface {
+	// ListClans - Retrieve all clan records
+	ListClans(ctx context.Context) ([]Clan, error)
+	// GetClan - Retrieve a single clan record matching filter
+	GetClan(ctx context.Context, filter ClanFilter) (Clan, error)
+	// UpdateClan - Update a clan record, with optional upsert
+	UpdateClan(ctx context.Context, clanData Clan, upsert bool) error
+
+	// ListPlayers - Retrieve all player records
+	ListPlayers(ctx context.Context) ([]Player, error)
+	// GetPlayer - Retrieve a single player record matching filter
+	GetPlayer(ctx context.Context, filter PlayerFilter) (Player, error)
+	// UpdatePlayer - Update a player record, with optional upsert
+	UpdatePlayer(ctx context.Context, playerData Player, upsert bool) error
+
+	// ListTankAverages - Get averages data for all tanks
+	ListTankAverages(ctx context.Context) ([]TankAverages, error)
+	// GetVehicleSnapshot - Get the vehicle stats saved for a player at session start
+	GetVehicleSnapshot(ctx context.Context, realm string, playerID int) (VehicleSnapshot, error)
+	// UpdateVehicleSnapshot - Save vehicle stats for a player, replacing any existing snapshot
+	UpdateVehicleSnapshot(ctx context.Context, snapshot VehicleSnapshot) error
+
+	// ListTrackingWindows - Retrieve all tracking windows of a clan ordered by name
+	ListTrackingWindows(ctx context.Context, realm string, clanID int) ([]TrackingWindow, error)
+	// GetTrackingWindow - Retrieve a tracking window of a clan by name
+	GetTrackingWindow(ctx context.Context, realm string, clanID int, name string) (TrackingWindow, error)
+	// UpdateTrackingWindow - Save a tracking window, replacing any existing one with the same name
+	UpdateTrackingWindow(ctx context.Context, window TrackingWindow) error
+	// DeleteTrackingWindow - Remove a tracking window and all of its baselines
+	DeleteTrackingWindow(ctx context.Context, realm string, clanID int, name string) error
+	// GetWindowSnapshot - Get the vehicle stats saved for a player when a tracking window started
+	GetWindowSnapshot(ctx context.Context, realm string, clanID int, window string, playerID int) (WindowSnapshot, error)
+	// UpdateWindowSnapshot - Save a tracking window baseline for a player, replacing any existing one
+	UpdateWindowSnapshot(ctx context.Context, snapshot WindowSnapshot) error
+
+	// AddSnapshot - Record player totals at a point in time
+	AddSnapshot(ctx context.Context, snapshot Snapshot) error
+	// GetSnapshots - Get snapshots matching filter, oldest first
+	GetSnapshots(ctx context.Context, filter SnapshotFilter) ([]Snapshot, error)
+	// GetLatestSnapshots - Get the most recent snapshot of each player matching filter, ordered by player ID
+	GetLatestSnapshots(ctx context.Context, filter SnapshotFilter) ([]Snapshot, error)
+
+	// UpdateDailyActivity - Save daily rollups, replacing existing rows for the same realm, clan, player and date
+	UpdateDailyActivity(ctx context.Context, days []DailyActivity) error
+	// GetDailyActivity - Get daily rollups matching filter, ordered by date
+	GetDailyActivity(ctx context.Context, filter DailyActivityFilter) ([]DailyActivity, error)
+
+	// AddMemberEvents - Record clan roster changes
+	AddMemberEvents(ctx context.Context, events []MemberEvent) error
+	// GetMemberEvents - Get roster changes matching filter, oldest first
+	GetMemberEvents(ctx context.Context, filter MemberEventFilter) ([]MemberEvent, error)
+
+	// ListClanSchedules - Retrieve background refresh state of all clans
+	ListClanSchedules(ctx context.Context) ([]ClanSchedule, error)
+	// UpdateClanSchedule - Save background refresh state for a clan, replacing any existing one
+	UpdateClanSchedule(ctx context.Context, schedule ClanSchedule) error
+
+	// AddClanSession - Archive a closed clan session
+	AddClanSession(ctx context.Context, session ClanSession) error
+	// ListClanSessions - Get archived sessions matching filter, newest first
+	ListClanSessions(ctx context.Context, filter ClanSessionFilter) ([]ClanSession, error)
+	// GetClanSession - Get an archived session of a clan by ID
+	GetClanSession(ctx context.Context, realm string, clanID int, sessionID int64) (ClanSession, error)
+
+	// GetJob - Retrieve a background job by ID
+	GetJob(ctx context.Context, id string) (Job, error)
+	// ListJobs - Retrieve background jobs matching filter, oldest first
+	ListJobs(ctx context.Context, filter JobFilter) ([]Job, error)
+	// UpdateJob - Save a background job, replacing any existing one with the same ID
+	UpdateJob(ctx context.Context, job Job) error
+
+	// GetTankAvg - Get averages data for a tank matching filter
+	GetTankAvg(ctx context.Context, filter TankFilter) (TankAverages, error)
+
+	// Close - Release all resources held by the backend
+	Close(ctx context.Context) error
+}
+
+// ClanFilter - Fields used to look up a clan, zero values are ignored
+type ClanFilter struct {
+	ID    int
+	Tag   string
+	Realm string
+}
+
+// Empty - Filter has neither an ID nor a tag, a realm alone matches every clan in it
+func (f ClanFilter) Empty() bool {
+	return f.ID == 0 && f.Tag == ""
+}
+
+// Normalize - Normalize tag and realm the same way NormalizeClan does for stored records
+func (f ClanFilter) Normalize() ClanFilter {
+	f.Tag = strings.ToUpper(f.Tag)
+	f.Realm = NormalizeRealm(f.Realm)
+	return f
+}
+
+// Match - Check a stored clan against a normalized filter
+func (f ClanFilter) Match(clan Clan) bool {
+	if f.ID != 0 && clan.ID != f.ID {
+		return false
+	}
+	if f.Tag != "" && clan.ClanTag != f.Tag {
+		return false
+	}
+	if f.Realm != "" && clan.Realm != f.Realm {
+		return false
+	}
+	return true
+}
+
+// NormalizeClan - Uppercase tag and normalize realm before a clan is written, lookups compare them exactly
+func NormalizeClan(clanData Clan) Clan {
+	clanData.ClanTag = strings.ToUpper(clanData.ClanTag)
+	clanData.Realm = NormalizeRealm(clanData.Realm)
+	return clanData
+}
+
+// PlayerFilter - Fields used to look up a player, zero values are ignored
+type PlayerFilter struct {
+	ID    int
+	Realm string
+}
+
+// Empty - Filter has no ID, a realm alone matches every player in it
+func (f PlayerFilter) Empty() bool {
+	return f.ID == 0
+}
+
+// Normalize - Normalize realm the same way NormalizePlayer does for stored records
+func (f PlayerFilter) Normalize() PlayerFilter {
+	f.Realm = NormalizeRealm(f.Realm)
+	return f
+}
+
+// Match - Check a stored player against a normalized filter
+func (f PlayerFilter) Match(player Player) bool {
+	if f.ID != 0 && player.ID != f.ID {
+		return false
+	}
+	if f.Realm != "" && player.Realm != f.Realm {
+		return false
+	}
+	return true
+}
+
+// NormalizePlayer - Normalize realm before a player is written, lookups compare it exactly
+func NormalizePlayer(playerData Player) Player {
+	playerData.Realm = NormalizeRealm(playerData.Realm)
+	return playerData
+}
+
+// SnapshotFilter - Fields used to look up snapshots, zero values are ignored
+// From is inclusive and To is exclusive
+type SnapshotFilter struct {
+	Realm     string
+	PlayerID  int
+	PlayerIDs []int
+	ClanID    int
+	From      time.Time
+	To        time.Time
+}
+
+// Normalize - Normalize realm the same way it is stored
+func (f SnapshotFilter) Normalize() SnapshotFilter {
+	f.Realm = NormalizeRealm(f.Realm)
+	return f
+}
+
+// Match - Check if a snapshot matches a normalized filter
+func (f SnapshotFilter) Match(snapshot Snapshot) bool {
+	if f.Realm != "" && snapshot.Realm != f.Realm {
+		return false
+	}
+	if f.PlayerID != 0 && snapshot.PlayerID != f.PlayerID {
+		return false
+	}
+	if len(f.PlayerIDs) > 0 && !containsID(f.PlayerIDs, snapshot.PlayerID) {
+		return false
+	}
+	if f.ClanID != 0 && snapshot.ClanID != f.ClanID {
+		return false
+	}
+	if !f.From.IsZero() && snapshot.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !snapshot.Timestamp.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// containsID - Check if ids contains id
+func containsID(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// DailyActivityFilter - Fields used to look up daily rollups, zero values are ignored
+// From and To are inclusive YYYY-MM-DD dates
+type DailyActivityFilter struct {
+	Realm    string
+	ClanID   int
+	PlayerID int
+	From     string
+	To       string
+}
+
+// Normalize - Normalize realm the same way it is stored
+func (f DailyActivityFilter) Normalize() DailyActivityFilter {
+	f.Realm = NormalizeRealm(f.Realm)
+	return f
+}
+
+// Match - Check if a daily rollup matches a normalized filter
+func (f DailyActivityFilter) Match(day DailyActivity) bool {
+	if f.Realm != "" && day.Realm != f.Realm {
+		return false
+	}
+	if f.ClanID != 0 && day.ClanID != f.ClanID {
+		return false
+	}
+	if f.PlayerID != 0 && day.PlayerID != f.PlayerID {
+		return false
+	}
+	if f.From != "" && day.Date < f.From {
+		return false
+	}
+	if f.To != "" && day.Date > f.To {
+		return false
+	}
+	return true
+}
+
+// MemberEventFilter - Fields used to look up roster changes, zero values are ignored
+// From is inclusive and To is exclusive
+type MemberEventFilter struct {
+	Realm    string
+	ClanID   int
+	PlayerID int
+	Type     string
+	From     time.Time
+	To       time.Time
+}
+
+// Normalize - Normalize realm the same way it is stored
+func (f MemberEventFilter) Normalize() MemberEventFilter {
+	f.Realm = NormalizeRealm(f.Realm)
+	return f
+}
+
+// Match - Check if a roster change matches a normalized filter
+func (f MemberEventFilter) Match(event MemberEvent) bool {
+	if f.Realm != "" && event.Realm != f.Realm {
+		return false
+	}
+	if f.ClanID != 0 && event.ClanID != f.ClanID {
+		return false
+	}
+	if f.PlayerID != 0 && event.PlayerID != f.PlayerID {
+		return false
+	}
+	if f.Type != "" && event.Type != f.Type {
+		return false
+	}
+	if !f.From.IsZero() && event.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !event.Timestamp.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// ClanSessionFilter - Fields used to look up archived sessions, zero values are ignored
+// From is inclusive and To is exclusive, both are compared to the session end
+type ClanSessionFilter struct {
+	Realm  string
+	ClanID int
+	From   time.Time
+	To     time.Time
+}
+
+// Normalize - Normalize realm the same way it is stored
+func (f ClanSessionFilter) Normalize() ClanSessionFilter {
+	f.Realm = NormalizeRealm(f.Realm)
+	return f
+}
+
+// Match - Check if an archived session matches a normalized filter
+func (f ClanSessionFilter) Match(session ClanSession) bool {
+	if f.Realm != "" && session.Realm != f.Realm {
+		return false
+	}
+	if f.ClanID != 0 && session.ClanID != f.ClanID {
+		return false
+	}
+	if !f.From.IsZero() && session.EndedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !session.EndedAt.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// JobFilter - Fields used to look up background jobs, zero values are ignored
+type JobFilter struct {
+	Status string
+}
+
+// Match - Check if a job matches the filter
+func (f JobFilter) Match(job Job) bool {
+	return f.Status == "" || job.Status == f.Status
+}
+
+// TankFilter - Fields used to look up tank averages, zero values are ignored
+type TankFilter struct {
+	TankID int
+}
+
+// Empty - Filter has no tank ID
+func (f TankFilter) Empty() bool {
+	return f.TankID == 0
+}
+
+// TankAverages - Struct for getting tank averages data from DB
+type TankAverages struct {
+	TankID int `bson:"tank_id" json:"tank_id"`
+	All    struct {
+		Battles              float64 `bson:"battles,omitempty" json:"battles,omitempty"`
+		DroppedCapturePoints float64 `bson:"dropped_capture_points,omitempty" json:"dropped_capture_points,omitempty"`
+	} `bson:"all" json:"all"`
+	Special struct {
+		Winrate         float64 `bson:"winrate,omitempty" json:"winrate,omitempty"`
+		DamageRatio     float64 `bson:"damageRatio,omitempty" json:"damageRatio,omitempty"`
+		Kdr             float64 `bson:"kdr,omitempty" json:"kdr,omitempty"`
+		DamagePerBattle float64 `bson:"damagePerBattle,omitempty" json:"damagePerBattle,omitempty"`
+		KillsPerBattle  float64 `bson:"killsPerBattle,omitempty" json:"killsPerBattle,omitempty"`
+		HitsPerBattle   float64 `bson:"hitsPerBattle,omitempty" json:"hitsPerBattle,omitempty"`
+		SpotsPerBattle  float64 `bson:"spotsPerBattle,omitempty" json:"spotsPerBattle,omitempty"`
+		Wpm             float64 `bson:"wpm,omitempty" json:"wpm,omitempty"`
+		Dpm             float64 `bson:"dpm,omitempty" json:"dpm,omitempty"`
+		Kpm             float64 `bson:"kpm,omitempty" json:"kpm,omitempty"`
+		HitRate         float64 `bson:"hitRate,omitempty" json:"hitRate,omitempty"`
+		SurvivalRate    float64 `bson:"survivalRate,omitempty" json:"survivalRate,omitempty"`
+	} `bson:"special" json:"special"`
+	Name   string `bson:"name" json:"name"`
+	Tier   int    `bson:"tier" json:"tier"`
+	Nation string `bson:"nation" json:"nation"`
+}
+
+// Clan DB record struct
+type Clan struct {
+	ID            int            `bson:"clan_id" json:"clan_id"`
+	ClanName      string         `bson:"clan_name" json:"clan_name"`
+	ClanTag       string         `bson:"clan_tag" json:"clan_tag"`
+	MembersIds    []int          `bson:"members_ids" json:"members_ids"`
+	Realm         string         `bson:"realm" json:"realm"`
+	Timezone      string         `bson:"timezone" json:"timezone,omitempty"`
+	ResetSchedule *ResetSchedule `bson:"reset_schedule" json:"reset_schedule,omitempty"`
+	LastUpdate    time.Time      `bson:"last_update" json:"last_update"`
+}
+
+// ResetSchedule - Weekly or daily session reset time in the clan time zone
+type ResetSchedule struct {
+	// Weekday - Day of the week, e.g. monday, empty to reset every day
+	Weekday string `bson:"weekday,omitempty" json:"weekday,omitempty"`
+	// Time - Time of day as HH:MM
+	Time string `bson:"time" json:"time"`
+	// Since - When the schedule was set, no resets are due before it
+	Since time.Time `bson:"since" json:"since"`
+}
+
+// Player DB record struct
+type Player struct {
+	ID                int              `bson:"player_id" json:"player_id"`
+	Realm             string           `bson:"realm" json:"realm"`
+	ClanID            int              `bson:"clan_id,omitempty" json:"clan_id,omitempty"`
+	JoinedAt          int              `bson:"joined_at" json:"joined_at"`
+	LeftAt            *time.Time       `bson:"left_at" json:"left_at,omitempty"`
+	Role              string           `bson:"role" json:"role,omitempty"`
+	Nickname          string           `bson:"nickname" json:"nickname"`
+	LastBattleTime    int              `bson:"last_battle_time" json:"last_battle_time,omitempty"`
+	PremiumExpiration int              `bson:"premium_expiration" json:"premium_expiration"`
+	AverageRating     int              `bson:"average_rating" json:"average_rating"`
+	RatingType        string           `bson:"rating_type" json:"rating_type"`
+	Battles           int              `bson:"battles" json:"battles"`
+	AccountBattles    int              `bson:"account_battles" json:"account_battles,omitempty"`
+	RatingBattles     int              `bson:"rating_battles" json:"rating_battles"`
+	SessionBattles    int              `json:"session_battles"`
+	SessionRating     int              `json:"session_rating"`
+	SessionStats      *PlayerStats     `bson:"-" json:"session_stats,omitempty"`
+	SessionVehicles   []SessionVehicle `bson:"-" json:"session_vehicles,omitempty"`
+	CareerStats       *PlayerStats     `bson:"career_stats,omitempty" json:"career_stats,omitempty"`
+	LastUpdate        time.Time        `bson:"last_update" json:"last_update"`
+}
+
+// TrackingWindow - Named period tracked alongside the clan session, with its own baseline per player
+type TrackingWindow struct {
+	ClanID    int       `bson:"clan_id" json:"clan_id"`
+	Realm     string    `bson:"realm" json:"realm"`
+	Name      string    `bson:"name" json:"name"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// WindowSnapshot - Per-vehicle stats of a player when a tracking window started
+type WindowSnapshot struct {
+	ClanID    int                  `bson:"clan_id" json:"clan_id"`
+	Realm     string               `bson:"realm" json:"realm"`
+	Window    string               `bson:"window" json:"window"`
+	PlayerID  int                  `bson:"player_id" json:"player_id"`
+	Vehicles  []wgapi.VehicleStats `bson:"vehicles" json:"vehicles"`
+	CreatedAt time.Time            `bson:"created_at" json:"created_at"`
+}
+
+// VehicleSnapshot - Per-vehicle stats of a player at session start
+type VehicleSnapshot struct {
+	PlayerID  int                  `bson:"player_id" json:"player_id"`
+	Realm     string               `bson:"realm" json:"realm"`
+	Vehicles  []wgapi.VehicleStats `bson:"vehicles" json:"vehicles"`
+	CreatedAt time.Time            `bson:"created_at" json:"created_at"`
+}
+
+// PlayerStats - Performance over a set of battles, rates are in percent
+type PlayerStats struct {
+	Battles        int     `bson:"battles" json:"battles"`
+	Winrate        float64 `bson:"winrate" json:"winrate"`
+	AverageDamage  float64 `bson:"average_damage" json:"average_damage"`
+	DamageRatio    float64 `bson:"damage_ratio" json:"damage_ratio"`
+	KillsPerBattle float64 `bson:"kills_per_battle" json:"kills_per_battle"`
+	SurvivalRate   float64 `bson:"survival_rate" json:"survival_rate"`
+	HitRate        float64 `bson:"hit_rate" json:"hit_rate"`
+	AverageXP      float64 `bson:"average_xp" json:"average_xp"`
+	Wins           int     `bson:"wins" json:"wins"`
+	DamageDealt    int     `bson:"damage_dealt" json:"damage_dealt"`
+}
+
+// SessionVehicle - Performance on a single vehicle during a session
+type SessionVehicle struct {
+	TankID        int     `bson:"tank_id" json:"tank_id"`
+	Name          string  `bson:"name" json:"name"`
+	Tier          int     `bson:"tier" json:"tier"`
+	Nation        string  `bson:"nation" json:"nation"`
+	Battles       int     `bson:"battles" json:"battles"`
+	Wins          int     `bson:"wins" json:"wins"`
+	Winrate       float64 `bson:"winrate" json:"winrate"`
+	DamageDealt   int     `bson:"damage_dealt" json:"damage_dealt"`
+	AverageDamage float64 `bson:"average_damage" json:"average_damage"`
+	Rating        int     `bson:"rating" json:"rating"`
+}
+
+// Snapshot - Player totals recorded on every refresh
+type Snapshot struct {
+	PlayerID   int       `bson:"player_id" json:"player_id"`
+	Realm      string    `bson:"realm" json:"realm"`
+	ClanID     int       `bson:"clan_id" json:"clan_id"`
+	Timestamp  time.Time `bson:"timestamp" json:"timestamp"`
+	Battles    int       `bson:"battles" json:"battles"`
+	Rating     int       `bson:"rating" json:"rating"`
+	RatingType string    `bson:"rating_type" json:"rating_type"`
+	Wins       int       `bson:"wins" json:"wins"`
+	Damage     int       `bson:"damage" json:"damage"`
+}
+
+// DailyActivity - Battles played on a single day by a player, or by a whole clan when PlayerID is 0
+// Date is YYYY-MM-DD in the clan timezone
+type DailyActivity struct {
+	ClanID    int       `bson:"clan_id" json:"clan_id"`
+	Realm     string    `bson:"realm" json:"realm"`
+	PlayerID  int       `bson:"player_id" json:"player_id,omitempty"`
+	Date      string    `bson:"date" json:"date"`
+	Battles   int       `bson:"battles" json:"battles"`
+	Wins      int       `bson:"wins" json:"wins"`
+	Damage    int       `bson:"damage" json:"damage"`
+	Players   int       `bson:"players,omitempty" json:"players,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Roster change types
+const (
+	MemberJoined = "member_joined"
+	MemberLeft   = "member_left"
+)
+
+// MemberEvent - A player joining or leaving a tracked clan
+type MemberEvent struct {
+	ClanID    int       `bson:"clan_id" json:"clan_id"`
+	Realm     string    `bson:"realm" json:"realm"`
+	PlayerID  int       `bson:"player_id" json:"player_id"`
+	Nickname  string    `bson:"nickname" json:"nickname"`
+	Type      string    `bson:"type" json:"type"`
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+}
+
+// ClanSchedule - Background refresh state of a clan
+type ClanSchedule struct {
+	ClanID       int           `bson:"clan_id" json:"clan_id"`
+	Realm        string        `bson:"realm" json:"realm"`
+	LastRun      time.Time     `bson:"last_run" json:"last_run"`
+	NextRun      time.Time     `bson:"next_run" json:"next_run"`
+	LastDuration time.Duration `bson:"last_duration" json:"last_duration_ns"`
+	LastLag      time.Duration `bson:"last_lag" json:"last_lag_ns"`
+	LastError    string        `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	LastReset    time.Time     `bson:"last_reset,omitempty" json:"last_reset,omitempty"`
+	NextReset    time.Time     `bson:"next_reset,omitempty" json:"next_reset,omitempty"`
+}
+
+// ClanSession - Session of a clan closed by a reset, ID is the end time in unix seconds
+// or one past the latest ID of the clan when an earlier reset ended in the same second
+type ClanSession struct {
+	ID            int64           `bson:"session_id" json:"session_id"`
+	ClanID        int             `bson:"clan_id" json:"clan_id"`
+	Realm         string          `bson:"realm" json:"realm"`
+	StartedAt     time.Time       `bson:"started_at" json:"started_at"`
+	EndedAt       time.Time       `bson:"ended_at" json:"ended_at"`
+	Battles       int             `bson:"battles" json:"battles"`
+	ActivePlayers int             `bson:"active_players" json:"active_players"`
+	Players       []SessionPlayer `bson:"players" json:"players,omitempty"`
+}
+
+// SessionPlayer - What a player did during an archived session
+type SessionPlayer struct {
+	PlayerID   int       `bson:"player_id" json:"player_id"`
+	Nickname   string    `bson:"nickname" json:"nickname"`
+	StartedAt  time.Time `bson:"started_at" json:"started_at"`
+	Battles    int       `bson:"battles" json:"battles"`
+	Rating     int       `bson:"rating" json:"rating"`
+	RatingType string    `bson:"rating_type" json:"rating_type"`
+}
+
+// Job types
+const (
+	JobEnroll  = "enroll"
+	JobReset   = "reset"
+	JobRefresh = "refresh"
+)
+
+// Job statuses
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job - Clan enrollment, reset or refresh running in the background
+type Job struct {
+	ID     string `bson:"_id" json:"job_id"`
+	Type   string `bson:"type" json:"type"`
+	Status string `bson:"status" json:"status"`
+	// Parameters
+	Realm           string `bson:"realm" json:"realm"`
+	ClanTag         string `bson:"clan_tag" json:"clan_tag"`
+	ClanID          int    `bson:"clan_id,omitempty" json:"clan_id,omitempty"`
+	Rating          string `bson:"rating,omitempty" json:"rating,omitempty"`
+	Window          string `bson:"window,omitempty" json:"window,omitempty"`
+	IncludeVehicles bool   `bson:"include_vehicles,omitempty" json:"include_vehicles,omitempty"`
+	// Progress
+	Players       int        `bson:"players" json:"players"`
+	PlayersDone   int        `bson:"players_done" json:"players_done"`
+	PlayersFailed int        `bson:"players_failed" json:"players_failed"`
+	Errors        []JobError `bson:"errors,omitempty" json:"errors,omitempty"`
+	// Outcome
+	Error      string          `bson:"error,omitempty" json:"error,omitempty"`
+	Result     json.RawMessage `bson:"result,omitempty" json:"result,omitempty"`
+	CreatedAt  time.Time       `bson:"created_at" json:"created_at"`
+	StartedAt  time.Time       `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt time.Time       `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// JobError - Failure of a single player during a job
+type JobError struct {
+	PlayerID int    `bson:"player_id" json:"player_id"`
+	Error    string `bson:"error" json:"error"`
+}
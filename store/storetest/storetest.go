@@ -0,0 +1,538 @@
+// Package storetest checks that a store.Store backend behaves like the others
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// Run - Run the conformance tests against stores created by newStore, every test gets an empty store
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, db store.Store)
+	}{
+		{"Clans", testClans},
+		{"Players", testPlayers},
+		{"VehicleSnapshots", testVehicleSnapshots},
+		{"TrackingWindows", testTrackingWindows},
+		{"Snapshots", testSnapshots},
+		{"DailyActivity", testDailyActivity},
+		{"MemberEvents", testMemberEvents},
+		{"ClanSchedules", testClanSchedules},
+		{"ClanSessions", testClanSessions},
+		{"Jobs", testJobs},
+		{"TankAverages", testTankAverages},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			db := newStore(t)
+			defer db.Close(context.Background())
+			tt.fn(t, db)
+		})
+	}
+}
+
+// base - Fixed time the test records are built around
+var base = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testClans(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	if err := db.UpdateClan(ctx, store.Clan{ID: 1, ClanTag: "abc", Realm: "na"}, false); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateClan without upsert on a missing clan = %v, want ErrNotFound", err)
+	}
+	// The same WG ID can belong to different clans in different realms
+	for _, clan := range []store.Clan{
+		{ID: 1, ClanTag: "abc", Realm: "na", MembersIds: []int{10, 11}},
+		{ID: 1, ClanTag: "XYZ", Realm: "EU"},
+	} {
+		if err := db.UpdateClan(ctx, clan, true); err != nil {
+			t.Fatalf("UpdateClan(%+v) = %v", clan, err)
+		}
+	}
+
+	clan, err := db.GetClan(ctx, store.ClanFilter{ID: 1, Realm: "NA"})
+	if err != nil {
+		t.Fatalf("GetClan by ID and realm = %v", err)
+	}
+	if clan.ClanTag != "ABC" || clan.Realm != "NA" || len(clan.MembersIds) != 2 {
+		t.Errorf("GetClan by ID and realm = %+v, want tag ABC on NA with 2 members", clan)
+	}
+	if clan.LastUpdate.IsZero() {
+		t.Error("UpdateClan did not set LastUpdate")
+	}
+	clan, err = db.GetClan(ctx, store.ClanFilter{Tag: "xyz", Realm: "eu"})
+	if err != nil || clan.ClanTag != "XYZ" || clan.Realm != "EU" {
+		t.Errorf("GetClan by tag and realm = %+v, %v, want XYZ on EU", clan, err)
+	}
+	if _, err := db.GetClan(ctx, store.ClanFilter{Tag: "ABC", Realm: "EU"}); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetClan with a tag from another realm = %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetClan(ctx, store.ClanFilter{Realm: "NA"}); !errors.Is(err, store.ErrEmptyFilter) {
+		t.Errorf("GetClan with an empty filter = %v, want ErrEmptyFilter", err)
+	}
+
+	if err := db.UpdateClan(ctx, store.Clan{ID: 1, ClanTag: "ABC", Realm: "NA", MembersIds: []int{10}}, false); err != nil {
+		t.Fatalf("UpdateClan without upsert on an existing clan = %v", err)
+	}
+	clans, err := db.ListClans(ctx)
+	if err != nil {
+		t.Fatalf("ListClans = %v", err)
+	}
+	if len(clans) != 2 {
+		t.Fatalf("ListClans returned %d clans, want 2", len(clans))
+	}
+	for _, clan := range clans {
+		if clan.Realm == "NA" && len(clan.MembersIds) != 1 {
+			t.Errorf("UpdateClan did not replace members: %v", clan.MembersIds)
+		}
+	}
+
+	// Changing a returned clan must not change the stored one
+	schedule := &store.ResetSchedule{Time: "04:00"}
+	if err := db.UpdateClan(ctx, store.Clan{ID: 2, Realm: "NA", MembersIds: []int{20}, ResetSchedule: schedule}, true); err != nil {
+		t.Fatalf("UpdateClan = %v", err)
+	}
+	schedule.Time = "05:00"
+	clan, err = db.GetClan(ctx, store.ClanFilter{ID: 2, Realm: "NA"})
+	if err != nil {
+		t.Fatalf("GetClan = %v", err)
+	}
+	clan.MembersIds[0] = 21
+	clan.ResetSchedule.Time = "06:00"
+	clan, err = db.GetClan(ctx, store.ClanFilter{ID: 2, Realm: "NA"})
+	if err != nil || clan.MembersIds[0] != 20 || clan.ResetSchedule == nil || clan.ResetSchedule.Time != "04:00" {
+		t.Errorf("GetClan after changing a saved and a returned clan = %+v, %v, want the saved values", clan, err)
+	}
+}
+
+func testPlayers(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	if err := db.UpdatePlayer(ctx, store.Player{ID: 10, Realm: "NA"}, false); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdatePlayer without upsert on a missing player = %v, want ErrNotFound", err)
+	}
+	for _, player := range []store.Player{
+		{ID: 10, Realm: "na", ClanID: 1, Nickname: "one"},
+		{ID: 10, Realm: "EU", ClanID: 2, Nickname: "other"},
+	} {
+		if err := db.UpdatePlayer(ctx, player, true); err != nil {
+			t.Fatalf("UpdatePlayer(%+v) = %v", player, err)
+		}
+	}
+
+	player, err := db.GetPlayer(ctx, store.PlayerFilter{ID: 10, Realm: "na"})
+	if err != nil || player.Nickname != "one" || player.Realm != "NA" {
+		t.Errorf("GetPlayer on NA = %+v, %v, want one on NA", player, err)
+	}
+	player, err = db.GetPlayer(ctx, store.PlayerFilter{ID: 10, Realm: "EU"})
+	if err != nil || player.Nickname != "other" {
+		t.Errorf("GetPlayer on EU = %+v, %v, want other", player, err)
+	}
+	if _, err := db.GetPlayer(ctx, store.PlayerFilter{ID: 10, Realm: "RU"}); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetPlayer in a realm without the player = %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetPlayer(ctx, store.PlayerFilter{Realm: "NA"}); !errors.Is(err, store.ErrEmptyFilter) {
+		t.Errorf("GetPlayer with an empty filter = %v, want ErrEmptyFilter", err)
+	}
+	players, err := db.ListPlayers(ctx)
+	if err != nil || len(players) != 2 {
+		t.Errorf("ListPlayers = %d players, %v, want 2", len(players), err)
+	}
+
+	// Changing a returned player must not change the stored one
+	leftAt := base
+	if err := db.UpdatePlayer(ctx, store.Player{ID: 20, Realm: "NA", LeftAt: &leftAt, CareerStats: &store.PlayerStats{Battles: 100}}, true); err != nil {
+		t.Fatalf("UpdatePlayer = %v", err)
+	}
+	leftAt = base.Add(time.Hour)
+	player, err = db.GetPlayer(ctx, store.PlayerFilter{ID: 20, Realm: "NA"})
+	if err != nil || player.LeftAt == nil || player.CareerStats == nil {
+		t.Fatalf("GetPlayer = %+v, %v, want left_at and career stats", player, err)
+	}
+	*player.LeftAt = base.Add(2 * time.Hour)
+	player.CareerStats.Battles = 200
+	players, err = db.ListPlayers(ctx)
+	if err != nil || len(players) != 3 {
+		t.Fatalf("ListPlayers = %d players, %v, want 3", len(players), err)
+	}
+	players[2].CareerStats.Battles = 300
+	player, err = db.GetPlayer(ctx, store.PlayerFilter{ID: 20, Realm: "NA"})
+	if err != nil || !player.LeftAt.Equal(base) || player.CareerStats.Battles != 100 {
+		t.Errorf("GetPlayer after changing a saved and a returned player = %+v, %v, want the saved values", player, err)
+	}
+}
+
+func testVehicleSnapshots(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	if _, err := db.GetVehicleSnapshot(ctx, "NA", 10); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetVehicleSnapshot before any was saved = %v, want ErrNotFound", err)
+	}
+	for _, snapshot := range []store.VehicleSnapshot{
+		{PlayerID: 10, Realm: "NA", Vehicles: []wgapi.VehicleStats{{TankID: 1}}, CreatedAt: base},
+		{PlayerID: 10, Realm: "NA", Vehicles: []wgapi.VehicleStats{{TankID: 1}, {TankID: 2}}, CreatedAt: base.Add(time.Hour)},
+		{PlayerID: 10, Realm: "EU", Vehicles: []wgapi.VehicleStats{{TankID: 3}}, CreatedAt: base},
+	} {
+		if err := db.UpdateVehicleSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("UpdateVehicleSnapshot = %v", err)
+		}
+	}
+
+	snapshot, err := db.GetVehicleSnapshot(ctx, "NA", 10)
+	if err != nil || len(snapshot.Vehicles) != 2 || !snapshot.CreatedAt.Equal(base.Add(time.Hour)) {
+		t.Errorf("GetVehicleSnapshot on NA = %+v, %v, want the replaced snapshot with 2 vehicles", snapshot, err)
+	}
+	snapshot.Vehicles[0].TankID = 99
+	snapshot, err = db.GetVehicleSnapshot(ctx, "NA", 10)
+	if err != nil || snapshot.Vehicles[0].TankID != 1 {
+		t.Errorf("GetVehicleSnapshot after changing a returned snapshot = %+v, %v, want tank 1", snapshot, err)
+	}
+	snapshot, err = db.GetVehicleSnapshot(ctx, "EU", 10)
+	if err != nil || len(snapshot.Vehicles) != 1 || snapshot.Vehicles[0].TankID != 3 {
+		t.Errorf("GetVehicleSnapshot on EU = %+v, %v, want tank 3", snapshot, err)
+	}
+}
+
+func testTrackingWindows(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	// Names that prefix each other are separate windows
+	for _, window := range []store.TrackingWindow{
+		{ClanID: 1, Realm: "NA", Name: "week", CreatedAt: base},
+		{ClanID: 1, Realm: "NA", Name: "event", CreatedAt: base},
+		{ClanID: 1, Realm: "NA", Name: "event2", CreatedAt: base},
+		{ClanID: 1, Realm: "EU", Name: "week", CreatedAt: base},
+	} {
+		if err := db.UpdateTrackingWindow(ctx, window); err != nil {
+			t.Fatalf("UpdateTrackingWindow = %v", err)
+		}
+	}
+	windows, err := db.ListTrackingWindows(ctx, "NA", 1)
+	if err != nil {
+		t.Fatalf("ListTrackingWindows = %v", err)
+	}
+	var names []string
+	for _, window := range windows {
+		names = append(names, window.Name)
+	}
+	if !equalStrings(names, []string{"event", "event2", "week"}) {
+		t.Errorf("ListTrackingWindows on NA = %v, want [event event2 week]", names)
+	}
+	if _, err := db.GetTrackingWindow(ctx, "EU", 1, "event"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetTrackingWindow from another realm = %v, want ErrNotFound", err)
+	}
+
+	for _, snapshot := range []store.WindowSnapshot{
+		{ClanID: 1, Realm: "NA", Window: "event", PlayerID: 10, Vehicles: []wgapi.VehicleStats{{TankID: 1}}},
+		{ClanID: 1, Realm: "NA", Window: "event2", PlayerID: 10, Vehicles: []wgapi.VehicleStats{{TankID: 2}}},
+		{ClanID: 1, Realm: "EU", Window: "week", PlayerID: 10, Vehicles: []wgapi.VehicleStats{{TankID: 3}}},
+	} {
+		if err := db.UpdateWindowSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("UpdateWindowSnapshot = %v", err)
+		}
+	}
+	snapshot, err := db.GetWindowSnapshot(ctx, "NA", 1, "event2", 10)
+	if err != nil || len(snapshot.Vehicles) != 1 || snapshot.Vehicles[0].TankID != 2 {
+		t.Errorf("GetWindowSnapshot = %+v, %v, want tank 2", snapshot, err)
+	}
+
+	// Deleting a window removes its baselines, but not the ones of a window with a longer name
+	if err := db.DeleteTrackingWindow(ctx, "NA", 1, "event"); err != nil {
+		t.Fatalf("DeleteTrackingWindow = %v", err)
+	}
+	if err := db.DeleteTrackingWindow(ctx, "NA", 1, "event"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("DeleteTrackingWindow twice = %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetTrackingWindow(ctx, "NA", 1, "event"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetTrackingWindow after delete = %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetWindowSnapshot(ctx, "NA", 1, "event", 10); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetWindowSnapshot after delete = %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetWindowSnapshot(ctx, "NA", 1, "event2", 10); err != nil {
+		t.Errorf("GetWindowSnapshot of another window after delete = %v", err)
+	}
+	if _, err := db.GetWindowSnapshot(ctx, "EU", 1, "week", 10); err != nil {
+		t.Errorf("GetWindowSnapshot in another realm after delete = %v", err)
+	}
+}
+
+func testSnapshots(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	for _, snapshot := range []store.Snapshot{
+		{PlayerID: 10, Realm: "NA", ClanID: 1, Timestamp: base.Add(-48 * time.Hour), Battles: 100},
+		{PlayerID: 10, Realm: "NA", ClanID: 1, Timestamp: base, Battles: 110},
+		{PlayerID: 11, Realm: "NA", ClanID: 1, Timestamp: base.Add(-time.Hour), Battles: 50},
+		{PlayerID: 10, Realm: "NA", ClanID: 1, Timestamp: base.Add(time.Hour), Battles: 120},
+		{PlayerID: 10, Realm: "EU", ClanID: 1, Timestamp: base.Add(30 * time.Minute), Battles: 7},
+		{PlayerID: 10, Realm: "ASIA", ClanID: 1, Timestamp: base, Battles: 3},
+	} {
+		if err := db.AddSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("AddSnapshot = %v", err)
+		}
+	}
+
+	// From is inclusive and To is exclusive
+	snapshots, err := db.GetSnapshots(ctx, store.SnapshotFilter{Realm: "NA", PlayerID: 10, From: base, To: base.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("GetSnapshots = %v", err)
+	}
+	if battles := snapshotBattles(snapshots); !equalInts(battles, []int{110}) {
+		t.Errorf("GetSnapshots for a player = %v, want [110]", battles)
+	}
+	snapshots, err = db.GetSnapshots(ctx, store.SnapshotFilter{Realm: "NA", ClanID: 1})
+	if err != nil {
+		t.Fatalf("GetSnapshots = %v", err)
+	}
+	if battles := snapshotBattles(snapshots); !equalInts(battles, []int{100, 50, 110, 120}) {
+		t.Errorf("GetSnapshots for a clan = %v, want [100 50 110 120] oldest first", battles)
+	}
+
+	latest, err := db.GetLatestSnapshots(ctx, store.SnapshotFilter{Realm: "NA", ClanID: 1, PlayerIDs: []int{10, 11}, To: base})
+	if err != nil {
+		t.Fatalf("GetLatestSnapshots = %v", err)
+	}
+	if battles := snapshotBattles(latest); !equalInts(battles, []int{100, 50}) {
+		t.Errorf("GetLatestSnapshots before base = %v, want [100 50] by player", battles)
+	}
+	latest, err = db.GetLatestSnapshots(ctx, store.SnapshotFilter{Realm: "EU"})
+	if err != nil {
+		t.Fatalf("GetLatestSnapshots = %v", err)
+	}
+	if battles := snapshotBattles(latest); !equalInts(battles, []int{7}) {
+		t.Errorf("GetLatestSnapshots on EU = %v, want [7]", battles)
+	}
+
+	// Realms in filters are matched the way they are stored, AS is ASIA
+	for _, realm := range []string{"asia", "as"} {
+		snapshots, err = db.GetSnapshots(ctx, store.SnapshotFilter{Realm: realm, PlayerID: 10})
+		if err != nil || !equalInts(snapshotBattles(snapshots), []int{3}) {
+			t.Errorf("GetSnapshots on %q = %+v, %v, want the ASIA snapshot", realm, snapshots, err)
+		}
+		latest, err = db.GetLatestSnapshots(ctx, store.SnapshotFilter{Realm: realm})
+		if err != nil || !equalInts(snapshotBattles(latest), []int{3}) {
+			t.Errorf("GetLatestSnapshots on %q = %+v, %v, want the ASIA snapshot", realm, latest, err)
+		}
+	}
+}
+
+func testDailyActivity(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	days := []store.DailyActivity{
+		{ClanID: 1, Realm: "NA", Date: "2021-03-02", Battles: 5},
+		{ClanID: 1, Realm: "NA", Date: "2021-03-01", Battles: 3},
+		{ClanID: 1, Realm: "NA", PlayerID: 10, Date: "2021-03-01", Battles: 3},
+		{ClanID: 1, Realm: "EU", Date: "2021-03-01", Battles: 9},
+	}
+	if err := db.UpdateDailyActivity(ctx, days); err != nil {
+		t.Fatalf("UpdateDailyActivity = %v", err)
+	}
+	// Rows of the same realm, clan, player and date are replaced
+	if err := db.UpdateDailyActivity(ctx, []store.DailyActivity{{ClanID: 1, Realm: "NA", Date: "2021-03-02", Battles: 6}}); err != nil {
+		t.Fatalf("UpdateDailyActivity = %v", err)
+	}
+
+	rows, err := db.GetDailyActivity(ctx, store.DailyActivityFilter{Realm: "NA", ClanID: 1, From: "2021-03-01", To: "2021-03-02"})
+	if err != nil {
+		t.Fatalf("GetDailyActivity = %v", err)
+	}
+	var clanBattles []int
+	for _, row := range rows {
+		if row.PlayerID == 0 {
+			clanBattles = append(clanBattles, row.Battles)
+		}
+	}
+	if len(rows) != 3 || !equalInts(clanBattles, []int{3, 6}) {
+		t.Errorf("GetDailyActivity on NA = %+v, want 3 rows with clan totals [3 6] by date", rows)
+	}
+	rows, err = db.GetDailyActivity(ctx, store.DailyActivityFilter{Realm: "na", PlayerID: 10})
+	if err != nil || len(rows) != 1 || rows[0].Battles != 3 {
+		t.Errorf("GetDailyActivity for a player = %+v, %v, want one row with 3 battles", rows, err)
+	}
+	rows, err = db.GetDailyActivity(ctx, store.DailyActivityFilter{Realm: "EU", ClanID: 1, To: "2021-02-28"})
+	if err != nil || len(rows) != 0 {
+		t.Errorf("GetDailyActivity before the first day = %+v, %v, want none", rows, err)
+	}
+}
+
+func testMemberEvents(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	events := []store.MemberEvent{
+		{ClanID: 1, Realm: "NA", PlayerID: 10, Type: store.MemberJoined, Timestamp: base},
+		{ClanID: 1, Realm: "NA", PlayerID: 10, Type: store.MemberLeft, Timestamp: base.Add(time.Hour)},
+		{ClanID: 1, Realm: "NA", PlayerID: 11, Type: store.MemberJoined, Timestamp: base.Add(2 * time.Hour)},
+		{ClanID: 1, Realm: "EU", PlayerID: 10, Type: store.MemberJoined, Timestamp: base},
+	}
+	if err := db.AddMemberEvents(ctx, events); err != nil {
+		t.Fatalf("AddMemberEvents = %v", err)
+	}
+
+	found, err := db.GetMemberEvents(ctx, store.MemberEventFilter{Realm: "NA", ClanID: 1})
+	if err != nil {
+		t.Fatalf("GetMemberEvents = %v", err)
+	}
+	if len(found) != 3 || found[0].Type != store.MemberJoined || found[1].Type != store.MemberLeft || found[2].PlayerID != 11 {
+		t.Errorf("GetMemberEvents on NA = %+v, want 3 events oldest first", found)
+	}
+	found, err = db.GetMemberEvents(ctx, store.MemberEventFilter{Realm: "NA", ClanID: 1, Type: store.MemberJoined, From: base.Add(time.Minute)})
+	if err != nil || len(found) != 1 || found[0].PlayerID != 11 {
+		t.Errorf("GetMemberEvents joined after base = %+v, %v, want player 11", found, err)
+	}
+	found, err = db.GetMemberEvents(ctx, store.MemberEventFilter{Realm: "eu", PlayerID: 10})
+	if err != nil || len(found) != 1 {
+		t.Errorf("GetMemberEvents on EU = %+v, %v, want one event", found, err)
+	}
+}
+
+func testClanSchedules(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	for _, schedule := range []store.ClanSchedule{
+		{ClanID: 1, Realm: "NA", NextRun: base},
+		{ClanID: 1, Realm: "EU", NextRun: base},
+		{ClanID: 1, Realm: "NA", NextRun: base.Add(time.Hour), LastError: "failed"},
+	} {
+		if err := db.UpdateClanSchedule(ctx, schedule); err != nil {
+			t.Fatalf("UpdateClanSchedule = %v", err)
+		}
+	}
+	schedules, err := db.ListClanSchedules(ctx)
+	if err != nil {
+		t.Fatalf("ListClanSchedules = %v", err)
+	}
+	if len(schedules) != 2 {
+		t.Fatalf("ListClanSchedules returned %d schedules, want one per realm", len(schedules))
+	}
+	for _, schedule := range schedules {
+		if schedule.Realm == "NA" && (!schedule.NextRun.Equal(base.Add(time.Hour)) || schedule.LastError != "failed") {
+			t.Errorf("UpdateClanSchedule did not replace the NA schedule: %+v", schedule)
+		}
+	}
+}
+
+func testClanSessions(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	for _, session := range []store.ClanSession{
+		{ID: 100, ClanID: 1, Realm: "NA", EndedAt: base, Players: []store.SessionPlayer{{PlayerID: 10, Battles: 4}}},
+		{ID: 200, ClanID: 1, Realm: "NA", EndedAt: base.Add(24 * time.Hour)},
+		{ID: 100, ClanID: 1, Realm: "EU", EndedAt: base, Battles: 9},
+	} {
+		if err := db.AddClanSession(ctx, session); err != nil {
+			t.Fatalf("AddClanSession = %v", err)
+		}
+	}
+
+	sessions, err := db.ListClanSessions(ctx, store.ClanSessionFilter{Realm: "NA", ClanID: 1})
+	if err != nil {
+		t.Fatalf("ListClanSessions = %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != 200 || sessions[1].ID != 100 {
+		t.Errorf("ListClanSessions on NA = %+v, want sessions 200 and 100, newest first", sessions)
+	}
+	sessions, err = db.ListClanSessions(ctx, store.ClanSessionFilter{Realm: "na", ClanID: 1, To: base.Add(time.Hour)})
+	if err != nil || len(sessions) != 1 || sessions[0].ID != 100 {
+		t.Errorf("ListClanSessions ended before To = %+v, %v, want session 100", sessions, err)
+	}
+
+	session, err := db.GetClanSession(ctx, "NA", 1, 100)
+	if err != nil || len(session.Players) != 1 || session.Players[0].Battles != 4 {
+		t.Errorf("GetClanSession on NA = %+v, %v, want one player with 4 battles", session, err)
+	}
+	session, err = db.GetClanSession(ctx, "eu", 1, 100)
+	if err != nil || session.Battles != 9 {
+		t.Errorf("GetClanSession on EU = %+v, %v, want 9 battles", session, err)
+	}
+	if _, err := db.GetClanSession(ctx, "EU", 1, 200); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetClanSession from another realm = %v, want ErrNotFound", err)
+	}
+}
+
+func testJobs(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	if _, err := db.GetJob(ctx, "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetJob before any was saved = %v, want ErrNotFound", err)
+	}
+	for _, job := range []store.Job{
+		{ID: "b", Status: store.JobQueued, CreatedAt: base.Add(time.Minute)},
+		{ID: "a", Status: store.JobQueued, CreatedAt: base},
+		{ID: "c", Status: store.JobDone, CreatedAt: base},
+		{ID: "a", Status: store.JobRunning, CreatedAt: base, Errors: []store.JobError{{PlayerID: 10, Error: "failed"}}},
+	} {
+		if err := db.UpdateJob(ctx, job); err != nil {
+			t.Fatalf("UpdateJob = %v", err)
+		}
+	}
+
+	job, err := db.GetJob(ctx, "a")
+	if err != nil || job.Status != store.JobRunning || len(job.Errors) != 1 {
+		t.Errorf("GetJob = %+v, %v, want the replaced running job", job, err)
+	}
+	jobs, err := db.ListJobs(ctx, store.JobFilter{Status: store.JobQueued})
+	if err != nil || len(jobs) != 1 || jobs[0].ID != "b" {
+		t.Errorf("ListJobs queued = %+v, %v, want job b", jobs, err)
+	}
+	jobs, err = db.ListJobs(ctx, store.JobFilter{})
+	if err != nil || len(jobs) != 3 || jobs[2].ID != "b" {
+		t.Errorf("ListJobs = %+v, %v, want 3 jobs oldest first", jobs, err)
+	}
+}
+
+func testTankAverages(t *testing.T, db store.Store) {
+	ctx := context.Background()
+
+	if _, err := db.GetTankAvg(ctx, store.TankFilter{}); !errors.Is(err, store.ErrEmptyFilter) {
+		t.Errorf("GetTankAvg with an empty filter = %v, want ErrEmptyFilter", err)
+	}
+	if _, err := db.GetTankAvg(ctx, store.TankFilter{TankID: 1}); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetTankAvg of an unknown tank = %v, want ErrNotFound", err)
+	}
+	tanks, err := db.ListTankAverages(ctx)
+	if err != nil || len(tanks) != 0 {
+		t.Errorf("ListTankAverages = %v, %v, want none", tanks, err)
+	}
+}
+
+func snapshotBattles(snapshots []store.Snapshot) []int {
+	battles := make([]int, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		battles = append(battles, snapshot.Battles)
+	}
+	return battles
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
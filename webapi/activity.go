@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
+	proc "github.com/cufee/am-clanactivity/processing"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// defaultActivityDays - Days returned when from is not set, including to
+const defaultActivityDays = 30
+
+// reqClanSettings - Settings to change, missing fields are left as they are
+// A reset schedule with an empty time removes the schedule
+type reqClanSettings struct {
+	Timezone      *string              `json:"timezone"`
+	ResetSchedule *store.ResetSchedule `json:"reset_schedule"`
+}
+
+// parseDateRange - Read from and to query parameters as YYYY-MM-DD dates
+// to defaults to today in loc and from defaults to 30 days up to and including to
+func parseDateRange(r *http.Request, loc *time.Location) (string, string, error) {
+	to := time.Now().In(loc)
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, loc)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid to: %v", err)
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, 1-defaultActivityDays)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, loc)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid from: %v", err)
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		return "", "", fmt.Errorf("from must not be after to")
+	}
+	return from.Format("2006-01-02"), to.Format("2006-01-02"), nil
+}
+
+// GET
+func (s *Server) clanActivity(w http.ResponseWriter, r *http.Request) {
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+	loc, err := proc.ClanLocation(clanData)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	from, to, err := parseDateRange(r, loc)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := s.db.GetDailyActivity(r.Context(), store.DailyActivityFilter{ClanID: clanData.ID, Realm: clanData.Realm, From: from, To: to})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Clan totals are stored without a player ID
+	days := []store.DailyActivity{}
+	players := make(map[string][]store.DailyActivity)
+	for _, row := range rows {
+		if row.PlayerID == 0 {
+			days = append(days, row)
+			continue
+		}
+		key := strconv.Itoa(row.PlayerID)
+		players[key] = append(players[key], row)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"clan_id": clanData.ID, "timezone": loc.String(), "from": from, "to": to, "days": days, "players": players})
+}
+
+// GET
+func (s *Server) playerActivity(w http.ResponseWriter, r *http.Request) {
+	realm, playerID, ok := playerFromPath(w, r)
+	if !ok {
+		return
+	}
+	// Optional clan scope, rollups of a player who changed clans are otherwise grouped by clan
+	var clanID int
+	if value := r.URL.Query().Get("clan_id"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid clan_id")
+			return
+		}
+		clanID = parsed
+	}
+	loc, err := s.playerLocation(r.Context(), realm, playerID, clanID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	from, to, err := parseDateRange(r, loc)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	days, err := s.db.GetDailyActivity(r.Context(), store.DailyActivityFilter{ClanID: clanID, Realm: string(realm), PlayerID: playerID, From: from, To: to})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	clans := make(map[string][]store.DailyActivity)
+	for _, day := range days {
+		key := strconv.Itoa(day.ClanID)
+		clans[key] = append(clans[key], day)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"player_id": playerID, "realm": realm, "timezone": loc.String(), "from": from, "to": to, "clans": clans})
+}
+
+// playerLocation - Time zone rollup dates of a player are in, from clanID or the current clan of the player
+// Players without a known clan get UTC
+func (s *Server) playerLocation(ctx context.Context, realm wgapi.Realm, playerID, clanID int) (*time.Location, error) {
+	if clanID == 0 {
+		playerData, err := s.db.GetPlayer(ctx, store.PlayerFilter{ID: playerID, Realm: string(realm)})
+		if errors.Is(err, store.ErrNotFound) {
+			return time.UTC, nil
+		} else if err != nil {
+			return nil, err
+		}
+		clanID = playerData.ClanID
+	}
+	if clanID == 0 {
+		return time.UTC, nil
+	}
+	clanData, err := s.db.GetClan(ctx, store.ClanFilter{ID: clanID, Realm: string(realm)})
+	if errors.Is(err, store.ErrNotFound) {
+		return time.UTC, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return proc.ClanLocation(clanData)
+}
+
+// PUT
+func (s *Server) updateClanSettings(w http.ResponseWriter, r *http.Request) {
+	var request reqClanSettings
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if request.Timezone != nil {
+		if _, err := time.LoadLocation(*request.Timezone); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		clanData.Timezone = *request.Timezone
+	}
+	if request.ResetSchedule != nil {
+		schedule := *request.ResetSchedule
+		if schedule.Time == "" {
+			clanData.ResetSchedule = nil
+		} else {
+			if _, err := proc.NextReset(schedule, time.UTC, time.Now()); err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			schedule.Weekday = strings.ToLower(schedule.Weekday)
+			schedule.Since = time.Now().UTC()
+			clanData.ResetSchedule = &schedule
+		}
+	}
+	if err := s.db.UpdateClan(r.Context(), clanData, false); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, clanData)
+}
+
+// POST
+func (s *Server) runRollups(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.proc.RollupAll(r.Context(), from, to)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"from": from, "to": to})
+}
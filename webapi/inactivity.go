@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultInactiveDays - Days without battles before a member is reported, when not set in the request
+const defaultInactiveDays = 14
+
+// GET
+func (s *Server) inactiveMembers(w http.ResponseWriter, r *http.Request) {
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	days := defaultInactiveDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			respondWithError(w, http.StatusBadRequest, "days must be a positive number")
+			return
+		}
+		days = parsed
+	}
+
+	report, err := s.proc.InactiveMembers(r.Context(), clanData, days, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
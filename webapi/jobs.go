@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	proc "github.com/cufee/am-clanactivity/processing"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+type jobAccepted struct {
+	JobID     string `json:"job_id"`
+	Status    string `json:"status"`
+	StatusURL string `json:"status_url"`
+}
+
+// submitJob - Queue a job and respond with 202 and where to follow its progress
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request, job store.Job) {
+	job, err := s.jobs.Submit(r.Context(), job)
+	if errors.Is(err, proc.ErrQueueFull) {
+		respondWithError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	statusURL := "/jobs/" + job.ID
+	w.Header().Set("Location", statusURL)
+	respondWithJSON(w, http.StatusAccepted, jobAccepted{JobID: job.ID, Status: job.Status, StatusURL: statusURL})
+}
+
+// POST
+func (s *Server) refreshClan(w http.ResponseWriter, r *http.Request) {
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	playerRating, err := rating.Get(query.Get("rating"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	window := query.Get("window")
+	if window != "" {
+		_, err := s.db.GetTrackingWindow(r.Context(), clanData.Realm, clanData.ID, window)
+		if errors.Is(err, store.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Tracking window "+window+" not found")
+			return
+		} else if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	s.submitJob(w, r, store.Job{
+		Type:            store.JobRefresh,
+		Realm:           clanData.Realm,
+		ClanTag:         clanData.ClanTag,
+		ClanID:          clanData.ID,
+		Rating:          playerRating.Name(),
+		Window:          window,
+		IncludeVehicles: query.Get("include_vehicles") == "true",
+	})
+}
+
+// GET
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.db.GetJob(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, store.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// POST
+func (s *Server) syncClanRoster(w http.ResponseWriter, r *http.Request) {
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	changes, err := s.proc.SyncClanRoster(r.Context(), clanData)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, changes)
+}
+
+// GET
+func (s *Server) clanMemberEvents(w http.ResponseWriter, r *http.Request) {
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.MemberEventFilter{ClanID: clanData.ID, Realm: clanData.Realm, Type: query.Get("type")}
+	if filter.Type != "" && filter.Type != store.MemberJoined && filter.Type != store.MemberLeft {
+		respondWithError(w, http.StatusBadRequest, "type must be "+store.MemberJoined+" or "+store.MemberLeft)
+		return
+	}
+	if value := query.Get("player_id"); value != "" {
+		playerID, err := strconv.Atoi(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid player id")
+			return
+		}
+		filter.PlayerID = playerID
+	}
+	// Events are rare, so the full history is returned unless a range is requested
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			parsed, err := parseTime(value)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "invalid "+name+": "+err.Error())
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	events, err := s.db.GetMemberEvents(r.Context(), filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if events == nil {
+		events = []store.MemberEvent{}
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"clan_id": clanData.ID, "events": events})
+}
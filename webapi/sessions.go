@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// GET
+func (s *Server) listClanSessions(w http.ResponseWriter, r *http.Request) {
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	filter := store.ClanSessionFilter{ClanID: clanData.ID, Realm: clanData.Realm}
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := r.URL.Query().Get(name); value != "" {
+			parsed, err := parseTime(value)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "invalid "+name+": "+err.Error())
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	sessions, err := s.db.ListClanSessions(r.Context(), filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Player breakdowns are only returned for a single session
+	for i := range sessions {
+		sessions[i].Players = nil
+	}
+	if sessions == nil {
+		sessions = []store.ClanSession{}
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"clan_id": clanData.ID, "sessions": sessions})
+}
+
+// GET
+func (s *Server) getClanSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session id")
+		return
+	}
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	session, err := s.db.GetClanSession(r.Context(), clanData.Realm, clanData.ID, sessionID)
+	if errors.Is(err, store.ErrNotFound) {
+		// Error 404
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, session)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// defaultHistoryRange - Time range returned when from is not set
+const defaultHistoryRange = 30 * 24 * time.Hour
+
+// parseTimeRange - Read from and to query parameters as RFC3339 timestamps or dates
+// to defaults to now and from defaults to 30 days before to
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := parseTime(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %v", err)
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultHistoryRange)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := parseTime(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %v", err)
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+// parseTime - Parse an RFC3339 timestamp or a YYYY-MM-DD date in UTC
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// GET
+func (s *Server) playerSnapshots(w http.ResponseWriter, r *http.Request) {
+	realm, playerID, ok := playerFromPath(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	snapshots, err := s.db.GetSnapshots(r.Context(), store.SnapshotFilter{Realm: string(realm), PlayerID: playerID, From: from, To: to})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if snapshots == nil {
+		snapshots = []store.Snapshot{}
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"player_id": playerID, "realm": realm, "from": from, "to": to, "snapshots": snapshots})
+}
+
+// GET
+func (s *Server) clanSnapshots(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	snapshots, err := s.db.GetSnapshots(r.Context(), store.SnapshotFilter{ClanID: clanData.ID, Realm: clanData.Realm, From: from, To: to})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Group the series by player, each series stays ordered by time
+	series := make(map[string][]store.Snapshot)
+	for _, snapshot := range snapshots {
+		key := strconv.Itoa(snapshot.PlayerID)
+		series[key] = append(series[key], snapshot)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"clan_id": clanData.ID, "from": from, "to": to, "players": series})
+}
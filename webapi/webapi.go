@@ -1,45 +1,116 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"log"
 	"strconv"
-	"time"
-
 	"sync"
+	"time"
 
 	"encoding/json"
 	"net/http"
 
 	"github.com/gorilla/mux"
 
-	mongo "github.com/cufee/am-clanactivity/mongoapi"
+	"github.com/cufee/am-clanactivity/config"
+	wgapi "github.com/cufee/am-clanactivity/externalapis/wargaming"
 	proc "github.com/cufee/am-clanactivity/processing"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/cufee/am-clanactivity/rating"
+	"github.com/cufee/am-clanactivity/store"
 )
 
 type exportJSON struct {
-	Clan    mongo.Clan     `json:"clan_data,omitempty"`
-	Members []mongo.Player `json:"players"`
+	Clan    store.Clan            `json:"clan_data,omitempty"`
+	Window  *store.TrackingWindow `json:"window,omitempty"`
+	Members []store.Player        `json:"players"`
 }
 
 type reqClanInfo struct {
-	Tag   string `json:"clan_tag"`
-	Realm string `json:"clan_realm"`
-	ID    string `json:"clan_id"`
+	Tag             string `json:"clan_tag"`
+	Realm           string `json:"clan_realm"`
+	ID              string `json:"clan_id"`
+	Rating          string `json:"rating"`
+	IncludeVehicles bool   `json:"include_vehicles"`
+	Window          string `json:"window"`
+}
+
+// Server - HTTP API for clan activity
+type Server struct {
+	db        store.Store
+	proc      *proc.Processor
+	wg        *wgapi.Client
+	scheduler *proc.Scheduler
+	jobs      *proc.JobQueue
+
+	mu   sync.Mutex
+	http *http.Server
+}
+
+// New - Create a new API server
+func New(db store.Store, processor *proc.Processor, wg *wgapi.Client, scheduler *proc.Scheduler, jobs *proc.JobQueue) *Server {
+	return &Server{db: db, proc: processor, wg: wg, scheduler: scheduler, jobs: jobs}
 }
 
-// HandleRequests - start API
-func HandleRequests(PORT int) {
-	log.Println("Starting webserver on", PORT)
-	hostPORT := ":" + strconv.Itoa(PORT)
+// HandleRequests - start API and serve requests until Shutdown is called
+func (s *Server) HandleRequests(cfg config.ServerConfig) error {
+	log.Println("Starting webserver on", cfg.ListenAddr)
 
 	myRouter := mux.NewRouter().StrictSlash(true)
 	// myRouter.HandleFunc("/clans", updateClanActivity)
-	myRouter.HandleFunc("/clan", addNewClan).Methods("POST")
-	myRouter.HandleFunc("/clan", updateClanActivity).Methods("PUT")
-	myRouter.HandleFunc("/clan", exportClanActivity).Methods("GET")
+	myRouter.HandleFunc("/clan", s.addNewClan).Methods("POST")
+	myRouter.HandleFunc("/clan", s.updateClanActivity).Methods("PUT")
+	myRouter.HandleFunc("/clan", s.exportClanActivity).Methods("GET")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/refresh", s.refreshClan).Methods("POST")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/snapshots", s.clanSnapshots).Methods("GET")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/activity", s.clanActivity).Methods("GET")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/settings", s.updateClanSettings).Methods("PUT")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/sync", s.syncClanRoster).Methods("POST")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/events", s.clanMemberEvents).Methods("GET")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/inactive", s.inactiveMembers).Methods("GET")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/sessions", s.listClanSessions).Methods("GET")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/sessions/{id:[0-9]+}", s.getClanSession).Methods("GET")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/windows", s.listTrackingWindows).Methods("GET")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/windows", s.createTrackingWindow).Methods("POST")
+	myRouter.HandleFunc("/clan/{realm}/{tag}/windows/{name}", s.deleteTrackingWindow).Methods("DELETE")
+	myRouter.HandleFunc("/jobs/{id}", s.getJob).Methods("GET")
+	myRouter.HandleFunc("/player/{realm}/{id:[0-9]+}/snapshots", s.playerSnapshots).Methods("GET")
+	myRouter.HandleFunc("/player/{realm}/{id:[0-9]+}/activity", s.playerActivity).Methods("GET")
+	myRouter.HandleFunc("/ratings", s.listRatings).Methods("GET")
+	myRouter.HandleFunc("/admin/ratelimit", s.rateLimitStats).Methods("GET")
+	myRouter.HandleFunc("/admin/tankaverages", s.tankAveragesStats).Methods("GET")
+	myRouter.HandleFunc("/admin/tankaverages", s.refreshTankAverages).Methods("POST")
+	myRouter.HandleFunc("/admin/rollups", s.runRollups).Methods("POST")
+	myRouter.HandleFunc("/admin/scheduler", s.schedulerStatus).Methods("GET")
+
+	server := &http.Server{
+		Addr:         cfg.ListenAddr,
+		Handler:      myRouter,
+		ReadTimeout:  cfg.ReadTimeout.Std(),
+		WriteTimeout: cfg.WriteTimeout.Std(),
+	}
+	s.mu.Lock()
+	s.http = server
+	s.mu.Unlock()
 
-	log.Fatal(http.ListenAndServe(hostPORT, myRouter))
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown - Stop accepting connections and wait for in-flight requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.http
+	s.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+
+	log.Println("Stopping webserver")
+	return server.Shutdown(ctx)
 }
 
 func respondWithError(w http.ResponseWriter, code int, message string) {
@@ -60,8 +131,47 @@ func respondWithCode(w http.ResponseWriter, code int) {
 	log.Println("Request - ", code)
 }
 
+// playerFromPath - Read the realm and player ID path variables, responding with an error when either is invalid
+// Player IDs are only unique within a realm
+func playerFromPath(w http.ResponseWriter, r *http.Request) (wgapi.Realm, int, bool) {
+	vars := mux.Vars(r)
+	realm, err := wgapi.ParseRealm(vars["realm"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return "", 0, false
+	}
+	playerID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid player id")
+		return "", 0, false
+	}
+	return realm, playerID, true
+}
+
+// clanFromPath - Load the clan named by the realm and tag path variables, responding with an error when it can not be found
+func (s *Server) clanFromPath(w http.ResponseWriter, r *http.Request) (store.Clan, bool) {
+	vars := mux.Vars(r)
+	realm, err := wgapi.ParseRealm(vars["realm"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return store.Clan{}, false
+	}
+
+	// Tags are only unique within a realm
+	clanData, err := s.db.GetClan(r.Context(), store.ClanFilter{Tag: vars["tag"], Realm: string(realm)})
+	if errors.Is(err, store.ErrNotFound) {
+		// Error 404
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return store.Clan{}, false
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return store.Clan{}, false
+	}
+	return clanData, true
+}
+
 // GET
-func exportClanActivity(w http.ResponseWriter, r *http.Request) {
+func (s *Server) exportClanActivity(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
 	var request reqClanInfo
@@ -72,25 +182,62 @@ func exportClanActivity(w http.ResponseWriter, r *http.Request) {
 	}
 
 	clanTag := request.Tag
-	clanRealm := request.Realm
-	if clanTag == (reqClanInfo{}.Tag) || clanRealm == (reqClanInfo{}.Realm) {
+	if clanTag == (reqClanInfo{}.Tag) || request.Realm == (reqClanInfo{}.Realm) {
 		// Check if both Tag and Realm are provided
 		respondWithError(w, http.StatusBadRequest, ("Clan tag or realm not provided"))
 		return
 	}
+	clanRealm, err := wgapi.ParseRealm(request.Realm)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	filter := bson.M{"clan_tag": clanTag}
-	clanData, err := mongo.GetClan(filter)
+	playerRating, err := rating.Get(request.Rating)
 	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	clanData, err := s.db.GetClan(r.Context(), store.ClanFilter{Tag: clanTag, Realm: string(clanRealm)})
+	if errors.Is(err, store.ErrNotFound) {
 		// Error 404
 		respondWithError(w, http.StatusNotFound, err.Error())
 		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 	var export exportJSON
 	export.Clan = clanData
 
-	response := make(chan mongo.Player, 51)
-	proc.PlayersFefreshSession(clanData.MembersIds, clanRealm, response)
+	// Session values can be relative to a tracking window instead of the clan session
+	windowName := request.Window
+	if windowName == "" {
+		windowName = r.URL.Query().Get("window")
+	}
+	if windowName != "" {
+		window, err := s.db.GetTrackingWindow(r.Context(), clanData.Realm, clanData.ID, windowName)
+		if errors.Is(err, store.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Tracking window "+windowName+" not found")
+			return
+		} else if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		export.Window = &window
+	}
+
+	// PlayersFefreshSession sends one result per member before it returns
+	response := make(chan store.Player, len(clanData.MembersIds))
+	opts := proc.RefreshOptions{
+		Rating: playerRating,
+		// Per-vehicle breakdown can be requested in the body or as ?include_vehicles=true
+		IncludeVehicles: request.IncludeVehicles || r.URL.Query().Get("include_vehicles") == "true",
+		ClanID:          clanData.ID,
+		Window:          windowName,
+	}
+	s.proc.PlayersFefreshSession(r.Context(), clanData.MembersIds, clanRealm, opts, response)
 
 	for r := range response {
 		if r.ID == 0 {
@@ -106,7 +253,7 @@ func exportClanActivity(w http.ResponseWriter, r *http.Request) {
 }
 
 // PUT
-func updateClanActivity(w http.ResponseWriter, r *http.Request) {
+func (s *Server) updateClanActivity(w http.ResponseWriter, r *http.Request) {
 	var request reqClanInfo
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
@@ -115,65 +262,33 @@ func updateClanActivity(w http.ResponseWriter, r *http.Request) {
 	}
 
 	clanTag := request.Tag
-	clanRealm := request.Realm
-	if clanTag == (reqClanInfo{}.Tag) || clanRealm == (reqClanInfo{}.Realm) {
+	if clanTag == (reqClanInfo{}.Tag) || request.Realm == (reqClanInfo{}.Realm) {
 		// Check if both Tag and Realm are provided
 		respondWithError(w, http.StatusBadRequest, ("Clan tag or realm not provided"))
 		return
 	}
-
-	filter := bson.M{"clan_tag": clanTag}
-	clanData, err := mongo.GetClan(filter)
+	clanRealm, err := wgapi.ParseRealm(request.Realm)
 	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	clanData, err := s.db.GetClan(r.Context(), store.ClanFilter{Tag: clanTag, Realm: string(clanRealm)})
+	if errors.Is(err, store.ErrNotFound) {
 		// Error 404
 		respondWithError(w, http.StatusNotFound, err.Error())
 		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	// Reset sessions for all players
-	var wg sync.WaitGroup
-	for i, pid := range clanData.MembersIds {
-		if (i % 20) == 0 {
-			time.Sleep(1 * time.Second)
-		}
-
-		wg.Add(1)
-		go func(pid int) {
-			defer wg.Done()
-
-			// Get player data
-			filter := bson.M{"_id": pid}
-			playerData, err := mongo.GetPlayer(filter)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			// Get player current battles
-			battles, err := proc.GetPlayerVehBattles(pid)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			// Update player record'
-			playerData.Battles = battles
-			playerData.SessionBattles = 0
-			playerData.SessionRating = 0
-			_, err = mongo.UpdatePlayer(playerData, true)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			return
-		}(pid)
-	}
-	// Send response
-	respondWithCode(w, http.StatusOK)
-	// Wait for player updates to finish
-	wg.Wait()
+	// Archive the closing session and reset sessions for all players in the background
+	s.submitJob(w, r, store.Job{Type: store.JobReset, Realm: string(clanRealm), ClanTag: clanData.ClanTag, ClanID: clanData.ID})
 }
 
 // POST
-func addNewClan(w http.ResponseWriter, r *http.Request) {
+func (s *Server) addNewClan(w http.ResponseWriter, r *http.Request) {
 	var request reqClanInfo
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
@@ -182,16 +297,50 @@ func addNewClan(w http.ResponseWriter, r *http.Request) {
 	}
 
 	clanTag := request.Tag
-	clanRealm := request.Realm
-	if clanTag == (reqClanInfo{}.Tag) || clanRealm == (reqClanInfo{}.Realm) {
+	if clanTag == (reqClanInfo{}.Tag) || request.Realm == (reqClanInfo{}.Realm) {
 		// Check if both Tag and Realm are provided
 		respondWithError(w, http.StatusBadRequest, ("Clan tag or realm not provided"))
+		return
 	}
+	clanRealm, err := wgapi.ParseRealm(request.Realm)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.submitJob(w, r, store.Job{Type: store.JobEnroll, Realm: string(clanRealm), ClanTag: clanTag})
+}
+
+// GET
+func (s *Server) listRatings(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"default": rating.Default, "ratings": rating.Names()})
+}
 
-	err = proc.EnableNewClan(clanRealm, clanTag)
+// GET
+func (s *Server) rateLimitStats(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, s.wg.LimiterStats())
+}
+
+// GET
+func (s *Server) tankAveragesStats(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, s.proc.TankCache().Stats())
+}
+
+// GET
+func (s *Server) schedulerStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := s.scheduler.Status(r.Context())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	respondWithCode(w, http.StatusOK)
+	respondWithJSON(w, http.StatusOK, status)
+}
+
+// POST
+func (s *Server) refreshTankAverages(w http.ResponseWriter, r *http.Request) {
+	if err := s.proc.TankCache().Refresh(r.Context()); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, s.proc.TankCache().Stats())
 }
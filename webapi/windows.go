@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	proc "github.com/cufee/am-clanactivity/processing"
+	"github.com/cufee/am-clanactivity/store"
+)
+
+// maxWindowName - Longest accepted tracking window name
+const maxWindowName = 64
+
+type reqTrackingWindow struct {
+	Name string `json:"name"`
+}
+
+// GET
+func (s *Server) listTrackingWindows(w http.ResponseWriter, r *http.Request) {
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	windows, err := s.db.ListTrackingWindows(r.Context(), clanData.Realm, clanData.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if windows == nil {
+		windows = []store.TrackingWindow{}
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"clan_id": clanData.ID, "windows": windows})
+}
+
+// POST
+func (s *Server) createTrackingWindow(w http.ResponseWriter, r *http.Request) {
+	var request reqTrackingWindow
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > maxWindowName || strings.Contains(name, "/") {
+		respondWithError(w, http.StatusBadRequest, "Window name must be 1-64 characters without slashes")
+		return
+	}
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	window, err := s.proc.CreateTrackingWindow(r.Context(), clanData, name)
+	if errors.Is(err, proc.ErrWindowExists) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, window)
+}
+
+// DELETE
+func (s *Server) deleteTrackingWindow(w http.ResponseWriter, r *http.Request) {
+	clanData, ok := s.clanFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.db.DeleteTrackingWindow(r.Context(), clanData.Realm, clanData.ID, mux.Vars(r)["name"])
+	if errors.Is(err, store.ErrNotFound) {
+		// Error 404
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithCode(w, http.StatusNoContent)
+}